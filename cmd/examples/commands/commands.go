@@ -41,6 +41,14 @@ func main() {
 	cmd = p.AddCommand("bar", "bar command", cmdBar)
 	cmd.AddOptionalArgument("arg-opt", "the optional argument")
 
+	cmd = p.AddCommand("baz", "baz command group", nil)
+	cmd.AddOption("e", "option-e", "value", "", "a command group option")
+	cmd = cmd.AddCommand("qux", "qux command", cmdQux)
+	cmd.AddArgument("arg-1", "the first argument")
+
+	p.EnableManPageFlag()
+	p.EnableDefinitionFlag()
+
 	p.ParseCommandLine()
 	p.Run()
 }
@@ -48,10 +56,10 @@ func main() {
 func cmdFoo(p *program.Program) {
 	p.Info("running command foo")
 
-	fmt.Printf("flag-a: %v\n", p.IsOptionSet("flag-a"))
-	fmt.Printf("b: %v\n", p.IsOptionSet("b"))
+	fmt.Printf("flag-a: %v\n", p.BoolOptionValue("flag-a"))
+	fmt.Printf("b: %v\n", p.BoolOptionValue("b"))
 	fmt.Printf("option-c: %s\n", p.OptionValue("option-c"))
-	fmt.Printf("flag-d: %v\n", p.IsOptionSet("flag-d"))
+	fmt.Printf("flag-d: %v\n", p.BoolOptionValue("flag-d"))
 
 	fmt.Printf("arg-1: %s\n", p.ArgumentValue("arg-1"))
 	fmt.Printf("arg-2: %s\n", p.ArgumentValue("arg-2"))
@@ -65,9 +73,17 @@ func cmdFoo(p *program.Program) {
 func cmdBar(p *program.Program) {
 	p.Info("running command bar")
 
-	fmt.Printf("flag-a: %v\n", p.IsOptionSet("flag-a"))
-	fmt.Printf("b: %v\n", p.IsOptionSet("b"))
+	fmt.Printf("flag-a: %v\n", p.BoolOptionValue("flag-a"))
+	fmt.Printf("b: %v\n", p.BoolOptionValue("b"))
 	fmt.Printf("option-c: %s\n", p.OptionValue("option-c"))
 
 	fmt.Printf("arg-opt: %s\n", p.ArgumentValue("arg-opt"))
 }
+
+func cmdQux(p *program.Program) {
+	p.Info("running command baz qux")
+
+	fmt.Printf("option-e: %s\n", p.OptionValue("option-e"))
+
+	fmt.Printf("arg-1: %s\n", p.ArgumentValue("arg-1"))
+}
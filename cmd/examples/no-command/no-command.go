@@ -46,8 +46,8 @@ func main() {
 }
 
 func main2(p *program.Program) {
-	fmt.Printf("flag-a: %v\n", p.IsOptionSet("flag-a"))
-	fmt.Printf("b: %v\n", p.IsOptionSet("b"))
+	fmt.Printf("flag-a: %v\n", p.BoolOptionValue("flag-a"))
+	fmt.Printf("b: %v\n", p.BoolOptionValue("b"))
 	fmt.Printf("option-c: %s\n", p.OptionValue("option-c"))
 
 	fmt.Printf("arg-1: %s\n", p.ArgumentValue("arg-1"))
@@ -17,20 +17,27 @@ package program
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"os"
-	"strconv"
+	"sort"
+	"strings"
 )
 
 type Command struct {
 	Name        string
 	Description string
 	Main        Main
+	Hidden      bool
 
 	program *Program
+	parent  *Command
+	builtin bool
 
-	options   map[string]*Option
-	arguments []*Argument
+	commands    map[string]*Command
+	options     map[string]*Option
+	arguments   []*Argument
+	constraints []*OptionConstraint
 }
 
 type Option struct {
@@ -40,8 +47,29 @@ type Option struct {
 	DefaultValue string
 	Description  string
 
-	Set   bool
-	Value string
+	Type       OptionType
+	TimeLayout string
+	Var        Value
+	Repeatable bool
+	Counted    bool
+	Separator  string
+	Negatable  bool
+	Choices    []string
+	Required   bool
+	Secret     bool
+	Complete   CompletionFunc
+
+	EnvironmentVariable string
+
+	Set     bool
+	Negated bool
+	Count   int
+	Value   string
+	Values  []string
+
+	value      interface{}
+	source     OptionSource
+	noNegation bool
 }
 
 type Argument struct {
@@ -49,6 +77,8 @@ type Argument struct {
 	Description string
 	Optional    bool
 	Trailing    bool
+	Var         Value
+	Complete    CompletionFunc
 
 	Set            bool
 	Value          string
@@ -67,7 +97,8 @@ func (p *Program) AddCommand(name, description string, main Main) *Command {
 
 		program: p,
 
-		options: make(map[string]*Option),
+		commands: make(map[string]*Command),
+		options:  make(map[string]*Option),
 	}
 
 	p.commands[name] = c
@@ -75,7 +106,84 @@ func (p *Program) AddCommand(name, description string, main Main) *Command {
 	return c
 }
 
-func (p *Program) AddOption(shortName, longName, valueName, defaultValue, description string) {
+func (c *Command) AddCommand(name, description string, main Main) *Command {
+	if c.Main != nil {
+		panic("cannot have a main function with commands")
+	}
+
+	c2 := &Command{
+		Name:        name,
+		Description: description,
+		Main:        main,
+
+		program: c.program,
+		parent:  c,
+
+		commands: make(map[string]*Command),
+		options:  make(map[string]*Option),
+	}
+
+	c.commands[name] = c2
+
+	return c2
+}
+
+func (c *Command) Path() []string {
+	var path []string
+
+	for ; c != nil; c = c.parent {
+		path = append([]string{c.Name}, path...)
+	}
+
+	return path
+}
+
+func (c *Command) FullName() string {
+	return strings.Join(c.Path(), " ")
+}
+
+func (p *Program) walkCommands(fn func(*Command)) {
+	var walk func(map[string]*Command)
+
+	walk = func(commands map[string]*Command) {
+		for _, c := range sortedCommands(commands) {
+			fn(c)
+			walk(c.commands)
+		}
+	}
+
+	walk(p.commands)
+}
+
+func sortedCommands(commands map[string]*Command) []*Command {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	sorted := make([]*Command, len(names))
+	for i, name := range names {
+		sorted[i] = commands[name]
+	}
+
+	return sorted
+}
+
+func visibleCommands(commands map[string]*Command) []*Command {
+	var visible []*Command
+
+	for _, c := range sortedCommands(commands) {
+		if !c.Hidden {
+			visible = append(visible, c)
+		}
+	}
+
+	return visible
+}
+
+func (p *Program) AddOption(shortName, longName, valueName, defaultValue, description string) *Option {
 	option := &Option{
 		ShortName:    shortName,
 		LongName:     longName,
@@ -85,13 +193,47 @@ func (p *Program) AddOption(shortName, longName, valueName, defaultValue, descri
 	}
 
 	p.addOption(nil, option)
+
+	return option
+}
+
+func (p *Program) AddTypedOption(optionType OptionType, shortName, longName, valueName, defaultValue, description string) *Option {
+	option := newTypedOption(optionType, shortName, longName, valueName,
+		defaultValue, description)
+
+	p.addOption(nil, option)
+
+	return option
+}
+
+func (p *Program) AddChoiceOption(shortName, longName, valueName, defaultValue string, choices []string, description string) *Option {
+	option := newChoiceOption(shortName, longName, valueName, defaultValue,
+		choices, description)
+
+	p.addOption(nil, option)
+
+	return option
+}
+
+func (p *Program) AddFlag(shortName, longName, description string) *Option {
+	return p.AddOption(shortName, longName, "", "", description)
+}
+
+func (p *Program) AddCountedFlag(shortName, longName, description string) *Option {
+	option := p.AddFlag(shortName, longName, description)
+	option.Counted = true
+
+	return option
 }
 
-func (p *Program) AddFlag(shortName, longName, description string) {
-	p.AddOption(shortName, longName, "", "", description)
+func (p *Program) AddNegatableFlag(shortName, longName, defaultValue, description string) *Option {
+	option := p.AddOption(shortName, longName, "", defaultValue, description)
+	option.Negatable = true
+
+	return option
 }
 
-func (c *Command) AddOption(shortName, longName, valueName, defaultValue, description string) {
+func (c *Command) AddOption(shortName, longName, valueName, defaultValue, description string) *Option {
 	option := &Option{
 		ShortName:    shortName,
 		LongName:     longName,
@@ -101,10 +243,78 @@ func (c *Command) AddOption(shortName, longName, valueName, defaultValue, descri
 	}
 
 	c.program.addOption(c, option)
+
+	return option
+}
+
+func (c *Command) AddTypedOption(optionType OptionType, shortName, longName, valueName, defaultValue, description string) *Option {
+	option := newTypedOption(optionType, shortName, longName, valueName,
+		defaultValue, description)
+
+	c.program.addOption(c, option)
+
+	return option
+}
+
+func (c *Command) AddChoiceOption(shortName, longName, valueName, defaultValue string, choices []string, description string) *Option {
+	option := newChoiceOption(shortName, longName, valueName, defaultValue,
+		choices, description)
+
+	c.program.addOption(c, option)
+
+	return option
+}
+
+func (c *Command) AddFlag(shortName, longName, description string) *Option {
+	return c.AddOption(shortName, longName, "", "", description)
+}
+
+func (c *Command) AddCountedFlag(shortName, longName, description string) *Option {
+	option := c.AddFlag(shortName, longName, description)
+	option.Counted = true
+
+	return option
+}
+
+func (c *Command) AddNegatableFlag(shortName, longName, defaultValue, description string) *Option {
+	option := c.AddOption(shortName, longName, "", defaultValue, description)
+	option.Negatable = true
+
+	return option
+}
+
+func newChoiceOption(shortName, longName, valueName, defaultValue string, choices []string, description string) *Option {
+	if len(choices) == 0 {
+		panic("missing choices")
+	}
+
+	option := &Option{
+		ShortName:    shortName,
+		LongName:     longName,
+		ValueName:    valueName,
+		DefaultValue: defaultValue,
+		Description:  description,
+
+		Type:    OptionTypeString,
+		Choices: choices,
+	}
+
+	return option
 }
 
-func (c *Command) AddFlag(shortName, longName, description string) {
-	c.AddOption(shortName, longName, "", "", description)
+func newTypedOption(optionType OptionType, shortName, longName, valueName, defaultValue, description string) *Option {
+	option := &Option{
+		ShortName:    shortName,
+		LongName:     longName,
+		ValueName:    valueName,
+		DefaultValue: defaultValue,
+		Description:  description,
+
+		Type:       optionType,
+		Repeatable: optionType == OptionTypeMap,
+	}
+
+	return option
 }
 
 func (p *Program) addOption(c *Command, option *Option) {
@@ -114,6 +324,11 @@ func (p *Program) addOption(c *Command, option *Option) {
 		panic("command has no short or long name")
 	}
 
+	if err := option.checkDefaultValue(); err != nil {
+		panicf("invalid default value %q for option %q: %v",
+			option.DefaultValue, option.name(), err)
+	}
+
 	if c == nil {
 		m = p.options
 	} else {
@@ -121,35 +336,80 @@ func (p *Program) addOption(c *Command, option *Option) {
 	}
 
 	if option.ShortName != "" {
-		if _, found := m[option.ShortName]; found {
-			panicf("duplicate option name %q", option.ShortName)
+		p.checkOptionName(c, option.ShortName)
+		m[option.ShortName] = option
+	}
+
+	if option.LongName != "" {
+		p.checkOptionName(c, option.LongName)
+		p.checkNegatedOptionName(c, option)
+
+		m[option.LongName] = option
+	}
+}
+
+func (p *Program) checkOptionName(c *Command, name string) {
+	if p.conflictingOption(c, name) != nil {
+		panicf("duplicate option name %q", name)
+	}
+}
+
+func (p *Program) checkNegatedOptionName(c *Command, option *Option) {
+	name := option.LongName
+
+	if option.negatable() {
+		if p.conflictingOption(c, "no-"+name) != nil {
+			panicf("option name %q conflicts with the negation of option %q",
+				"no-"+name, name)
 		}
+	}
 
-		if c != nil {
-			if _, found := c.program.options[option.ShortName]; found {
-				panicf("duplicate option name %q", option.ShortName)
-			}
+	if strings.HasPrefix(name, "no-") {
+		opt := p.conflictingOption(c, name[3:])
+		if opt != nil && opt.negatable() && opt.LongName == name[3:] {
+			panicf("option name %q conflicts with the negation of option %q",
+				name, name[3:])
 		}
+	}
+}
 
-		m[option.ShortName] = option
+func (p *Program) conflictingOption(c *Command, name string) *Option {
+	// Options are inherited by subcommands, so option names must be unique
+	// along any path of the command tree.
+
+	if opt, found := p.options[name]; found {
+		return opt
 	}
 
-	if option.LongName != "" {
-		if _, found := m[option.LongName]; found {
-			panicf("duplicate option name %q", option.LongName)
+	for parent := c; parent != nil; parent = parent.parent {
+		if opt, found := parent.options[name]; found {
+			return opt
 		}
+	}
+
+	var findInChildren func(map[string]*Command) *Option
+	findInChildren = func(commands map[string]*Command) *Option {
+		for _, child := range commands {
+			if opt, found := child.options[name]; found {
+				return opt
+			}
 
-		if c != nil {
-			if _, found := c.program.options[option.LongName]; found {
-				panicf("duplicate option name %q", option.LongName)
+			if opt := findInChildren(child.commands); opt != nil {
+				return opt
 			}
 		}
 
-		m[option.LongName] = option
+		return nil
+	}
+
+	if c == nil {
+		return findInChildren(p.commands)
 	}
+
+	return findInChildren(c.commands)
 }
 
-func (p *Program) AddArgument(name, description string) {
+func (p *Program) AddArgument(name, description string) *Argument {
 	checkForArgument(p.arguments)
 
 	arg := &Argument{
@@ -158,9 +418,11 @@ func (p *Program) AddArgument(name, description string) {
 	}
 
 	p.arguments = append(p.arguments, arg)
+
+	return arg
 }
 
-func (p *Program) AddOptionalArgument(name, description string) {
+func (p *Program) AddOptionalArgument(name, description string) *Argument {
 	checkForOptionalArgument(p.arguments)
 
 	arg := &Argument{
@@ -170,9 +432,11 @@ func (p *Program) AddOptionalArgument(name, description string) {
 	}
 
 	p.arguments = append(p.arguments, arg)
+
+	return arg
 }
 
-func (p *Program) AddTrailingArgument(name, description string) {
+func (p *Program) AddTrailingArgument(name, description string) *Argument {
 	checkForTrailingArgument(p.arguments)
 
 	arg := &Argument{
@@ -182,9 +446,11 @@ func (p *Program) AddTrailingArgument(name, description string) {
 	}
 
 	p.arguments = append(p.arguments, arg)
+
+	return arg
 }
 
-func (c *Command) AddArgument(name, description string) {
+func (c *Command) AddArgument(name, description string) *Argument {
 	checkForArgument(c.arguments)
 
 	arg := &Argument{
@@ -193,9 +459,11 @@ func (c *Command) AddArgument(name, description string) {
 	}
 
 	c.arguments = append(c.arguments, arg)
+
+	return arg
 }
 
-func (c *Command) AddOptionalArgument(name, description string) {
+func (c *Command) AddOptionalArgument(name, description string) *Argument {
 	checkForOptionalArgument(c.arguments)
 
 	arg := &Argument{
@@ -205,9 +473,11 @@ func (c *Command) AddOptionalArgument(name, description string) {
 	}
 
 	c.arguments = append(c.arguments, arg)
+
+	return arg
 }
 
-func (c *Command) AddTrailingArgument(name, description string) {
+func (c *Command) AddTrailingArgument(name, description string) *Argument {
 	checkForTrailingArgument(c.arguments)
 
 	arg := &Argument{
@@ -217,6 +487,8 @@ func (c *Command) AddTrailingArgument(name, description string) {
 	}
 
 	c.arguments = append(c.arguments, arg)
+
+	return arg
 }
 
 func checkForArgument(args []*Argument) {
@@ -267,10 +539,22 @@ func (p *Program) CommandName() string {
 	return p.command.Name
 }
 
+func (p *Program) CommandPath() []string {
+	if len(p.commands) == 0 {
+		panicf("no command defined")
+	}
+
+	return p.command.Path()
+}
+
 func (p *Program) IsOptionSet(name string) bool {
 	return p.mustOption(name).Set
 }
 
+func (p *Program) OptionCount(name string) int {
+	return p.mustOption(name).Count
+}
+
 func (p *Program) OptionValue(name string) string {
 	opt := p.mustOption(name)
 	if !opt.Set {
@@ -281,19 +565,23 @@ func (p *Program) OptionValue(name string) string {
 }
 
 func (p *Program) mustOption(name string) *Option {
-	if p.command != nil {
-		option, found := p.command.options[name]
+	option := p.findOption(p.command, name)
+	if option == nil {
+		panicf("unknown option %q", name)
+	}
+
+	return option
+}
+
+func (p *Program) findOption(command *Command, name string) *Option {
+	for c := command; c != nil; c = c.parent {
+		option, found := c.options[name]
 		if found {
 			return option
 		}
 	}
 
-	option, found := p.options[name]
-	if !found {
-		panicf("unknown option %q", name)
-	}
-
-	return option
+	return p.options[name]
 }
 
 func (p *Program) ArgumentValue(name string) string {
@@ -305,15 +593,7 @@ func (p *Program) TrailingArgumentValues(name string) []string {
 }
 
 func (p *Program) mustArgument(name string) *Argument {
-	var arguments []*Argument
-
-	if p.command == nil {
-		arguments = p.arguments
-	} else {
-		arguments = p.command.arguments
-	}
-
-	for _, argument := range arguments {
+	for _, argument := range p.currentArguments() {
 		if name == argument.Name {
 			return argument
 		}
@@ -324,66 +604,181 @@ func (p *Program) mustArgument(name string) *Argument {
 }
 
 func (p *Program) ParseCommandLine() {
-	if len(p.commands) > 0 {
-		p.addDefaultCommands()
+	if handled, err := p.handleBuiltinArgs(os.Stdout, os.Args[1:]); err != nil {
+		p.Fatal("%v", err)
+	} else if handled {
+		os.Exit(0)
 	}
 
-	p.parse()
+	if err := p.ParseArgs(os.Args[1:]); err != nil {
+		p.fatal("%v", err)
+	}
 
 	if p.IsOptionSet("help") {
 		cmdHelp(p)
 		os.Exit(0)
 	}
 
-	p.Quiet = p.IsOptionSet("quiet")
+	if p.DebugLevel >= OptionTableDebugLevel {
+		p.printOptionTable()
+	}
+}
+
+func (p *Program) handleBuiltinArgs(w io.Writer, args []string) (bool, error) {
+	// Some built-in features are triggered by the first argument and
+	// handled before parsing: the arguments which follow are not options
+	// and arguments of the program, and may be incomplete.
+
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	if len(p.commands) > 0 {
+		p.addDefaultCommands()
+	}
+
+	switch {
+	case args[0] == CompletionCommandName:
+		return true, p.writeCompletions(w, args[1:])
+
+	case args[0] == ManPageFlagName && p.manPageFlag:
+		return true, p.writeManPageForPath(w, args[1:])
+
+	case args[0] == DefinitionFlagName && p.definitionFlag:
+		if len(args) > 1 {
+			return true, &TooManyArgumentsError{}
+		}
+
+		return true, p.WriteDefinition(w)
+	}
+
+	return false, nil
+}
+
+func (p *Program) findCommandPath(path []string) (*Command, error) {
+	var command *Command
+
+	commands := p.commands
+	for _, name := range path {
+		var found bool
+
+		command, found = commands[name]
+		if !found {
+			return nil, &UnknownCommandError{Command: name}
+		}
+
+		commands = command.commands
+	}
+
+	return command, nil
+}
+
+func (p *Program) ParseArgs(args []string) error {
+	if len(p.commands) > 0 {
+		p.addDefaultCommands()
+	}
+
+	p.Quiet = false
+	p.DebugLevel = 0
+
+	if err := p.parse(args); err != nil {
+		return err
+	}
+
+	if p.IsOptionSet("help") {
+		return nil
+	}
+
+	p.Quiet = p.BoolOptionValue("quiet")
 
-	if p.IsOptionSet("debug") {
-		s := p.OptionValue("debug")
-		i, err := strconv.ParseInt(s, 10, 64)
-		if err != nil || i < 0 || i > math.MaxInt32 {
-			p.fatal("invalid debug level %v", s)
+	if p.debugFlag != nil {
+		p.DebugLevel = p.debugFlag.Count
+	} else if p.IsOptionSet("debug") {
+		level := p.IntOptionValue("debug")
+		if level < 0 || level > math.MaxInt32 {
+			return &InvalidOptionValueError{
+				Option: "debug",
+				Value:  p.OptionValue("debug"),
+				Err:    fmt.Errorf("invalid debug level"),
+			}
 		}
 
-		p.DebugLevel = int(i)
+		p.DebugLevel = level
 	}
+
+	return nil
 }
 
 func (p *Program) addDefaultOptions() {
-	p.AddFlag("h", "help", "print help and exit")
+	p.AddFlag("h", "help", "print help and exit").noNegation = true
 	p.AddFlag("q", "quiet", "do not print status and information messages")
-	p.AddOption("", "debug", "level", "0", "print debug messages")
+	p.AddTypedOption(OptionTypeInt, "", "debug", "level", "0",
+		"print debug messages")
 }
 
-func (p *Program) addDefaultCommands() {
-	c := p.AddCommand("help", "print help and exit", cmdHelp)
-	c.AddTrailingArgument("command", "the name of the command(s)")
+func (p *Program) SetDebugFlag(shortName, longName, description string) *Option {
+	// Replace the default "--debug <level>" option by a counted flag, each
+	// occurrence of the flag increasing the debug level.
+
+	if p.debugFlag == nil {
+		delete(p.options, "debug")
+	} else {
+		delete(p.options, p.debugFlag.ShortName)
+		delete(p.options, p.debugFlag.LongName)
+	}
+
+	p.debugFlag = p.AddCountedFlag(shortName, longName, description)
+
+	return p.debugFlag
 }
 
-func cmdHelp(p *Program) {
-	var commandNames []string
-	if p.command != nil {
-		if p.command.Name == "help" {
-			commandNames = p.TrailingArgumentValues("command")
-		} else {
-			commandNames = append(commandNames, p.command.Name)
-		}
+func (p *Program) addDefaultCommands() {
+	// Commands defined by the program take precedence over built-in
+	// commands with the same name.
+
+	if _, found := p.commands["help"]; !found {
+		c := p.AddCommand("help", "print help and exit", cmdHelp)
+		c.builtin = true
+		c.AddTrailingArgument("command", "the path of the command")
 	}
 
-	if len(commandNames) == 0 {
-		p.PrintUsage(nil)
-	} else {
-		for i, commandName := range commandNames {
-			if i > 0 {
-				fmt.Fprintf(os.Stderr, "\n\n")
+	if _, found := p.commands["completion"]; found {
+		return
+	}
+
+	c := p.AddCommand("completion", "print a shell completion script",
+		cmdCompletion)
+	c.builtin = true
+	c.AddArgument("shell", "the shell (bash, zsh or fish)").Complete =
+		func(string) []Completion {
+			completions := make([]Completion, len(CompletionShells))
+			for i, shell := range CompletionShells {
+				completions[i] = Completion{Value: shell}
 			}
 
-			command, found := p.commands[commandName]
+			return completions
+		}
+}
+
+func cmdHelp(p *Program) {
+	command := p.command
+
+	if command != nil && command == p.commands["help"] {
+		command = nil
+
+		commands := p.commands
+		for _, name := range p.TrailingArgumentValues("command") {
+			var found bool
+
+			command, found = commands[name]
 			if !found {
-				p.Error("unknown command %q", commandName)
+				p.Error("unknown command %q", name)
 				os.Exit(1)
 			}
 
-			p.PrintUsage(command)
+			commands = command.commands
 		}
 	}
+
+	p.PrintUsage(command)
 }
@@ -0,0 +1,93 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type Completion struct {
+	Value       string
+	Description string
+}
+
+// Completion functions return candidates for the word being completed. They
+// receive the partial word and can return candidates which do not match it;
+// these are filtered out.
+type CompletionFunc func(prefix string) []Completion
+
+func CompleteFiles(prefix string) []Completion {
+	return completePaths(prefix, false)
+}
+
+func CompleteDirectories(prefix string) []Completion {
+	return completePaths(prefix, true)
+}
+
+func completePaths(prefix string, dirOnly bool) []Completion {
+	dir, base := filepath.Split(prefix)
+
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var completions []Completion
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+			continue
+		}
+
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(readDir, name)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+
+		if dirOnly && !isDir {
+			continue
+		}
+
+		value := dir + name
+		if isDir {
+			value += "/"
+		}
+
+		completions = append(completions, Completion{Value: value})
+	}
+
+	sort.Slice(completions, func(i, j int) bool {
+		return completions[i].Value < completions[j].Value
+	})
+
+	return completions
+}
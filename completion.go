@@ -0,0 +1,775 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const CompletionCommandName = "__complete"
+
+var CompletionShells = []string{"bash", "zsh", "fish"}
+
+type completionScope struct {
+	path      string
+	commands  []*Command
+	options   []*Option
+	arguments []*Argument
+}
+
+func cmdCompletion(p *Program) {
+	if err := p.WriteCompletionScript(os.Stdout,
+		p.ArgumentValue("shell")); err != nil {
+		p.Fatal("%v", err)
+	}
+}
+
+func (p *Program) WriteCompletionScript(w io.Writer, shell string) error {
+	var buf bytes.Buffer
+
+	switch shell {
+	case "bash":
+		p.writeBashCompletion(&buf)
+	case "zsh":
+		p.writeZshCompletion(&buf)
+	case "fish":
+		p.writeFishCompletion(&buf)
+	default:
+		return fmt.Errorf("unsupported shell %q (supported shells: %s)",
+			shell, strings.Join(CompletionShells, ", "))
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (p *Program) completionScopes() []completionScope {
+	scopes := []completionScope{
+		{
+			commands:  visibleCommands(p.commands),
+			options:   p.scopeOptions(nil),
+			arguments: p.arguments,
+		},
+	}
+
+	p.walkCommands(func(c *Command) {
+		scopes = append(scopes, completionScope{
+			path:      c.FullName(),
+			commands:  visibleCommands(c.commands),
+			options:   p.scopeOptions(c),
+			arguments: c.arguments,
+		})
+	})
+
+	return scopes
+}
+
+func (p *Program) completionFunctionName() string {
+	return "_" + strings.Map(func(c rune) rune {
+		if c > unicode.MaxASCII ||
+			!(unicode.IsLetter(c) || unicode.IsDigit(c)) {
+			return '_'
+		}
+
+		return c
+	}, p.Name) + "_completion"
+}
+
+func (opt *Option) completionNames() []string {
+	var names []string
+
+	if opt.ShortName != "" {
+		names = append(names, "-"+opt.ShortName)
+	}
+
+	if opt.LongName != "" {
+		names = append(names, "--"+opt.LongName)
+
+		if opt.negatable() {
+			names = append(names, "--no-"+opt.LongName)
+		}
+	}
+
+	return names
+}
+
+func valueOptionNames(options []*Option) []string {
+	var names []string
+
+	for _, opt := range options {
+		if opt.isFlag() {
+			continue
+		}
+
+		if opt.ShortName != "" {
+			names = append(names, "-"+opt.ShortName)
+		}
+
+		if opt.LongName != "" {
+			names = append(names, "--"+opt.LongName)
+		}
+	}
+
+	return names
+}
+
+func commandNames(commands []*Command) []string {
+	names := make([]string, len(commands))
+	for i, c := range commands {
+		names[i] = c.Name
+	}
+
+	return names
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "'", `\'`)
+
+	return "'" + s + "'"
+}
+
+func shellQuoteWords(words []string) string {
+	return shellQuote(strings.Join(words, " "))
+}
+
+func (p *Program) writeBashCompletion(buf *bytes.Buffer) {
+	fn := p.completionFunctionName()
+	scopes := p.completionScopes()
+
+	writeCase := func(name string, words func(completionScope) []string) {
+		fmt.Fprintf(buf, "%s_%s() {\n", fn, name)
+		fmt.Fprintf(buf, "  case \"$1\" in\n")
+
+		for _, scope := range scopes {
+			if values := words(scope); len(values) > 0 {
+				fmt.Fprintf(buf, "    %s) echo %s ;;\n",
+					shellQuote(scope.path), shellQuoteWords(values))
+			}
+		}
+
+		fmt.Fprintf(buf, "  esac\n")
+		fmt.Fprintf(buf, "}\n\n")
+	}
+
+	fmt.Fprintf(buf, "# bash completion for %s\n\n", p.Name)
+
+	writeCase("commands", func(scope completionScope) []string {
+		return commandNames(scope.commands)
+	})
+
+	writeCase("options", func(scope completionScope) []string {
+		var names []string
+		for _, opt := range scope.options {
+			names = append(names, opt.completionNames()...)
+		}
+
+		return names
+	})
+
+	writeCase("value_options", func(scope completionScope) []string {
+		return valueOptionNames(scope.options)
+	})
+
+	fmt.Fprintf(buf, "%s_choices() {\n", fn)
+	fmt.Fprintf(buf, "  case \"$1|$2\" in\n")
+
+	for _, scope := range scopes {
+		for _, opt := range scope.options {
+			if len(opt.Choices) == 0 {
+				continue
+			}
+
+			for _, name := range valueOptionNames([]*Option{opt}) {
+				fmt.Fprintf(buf, "    %s) echo %s ;;\n",
+					shellQuote(scope.path+"|"+name),
+					shellQuoteWords(opt.Choices))
+			}
+		}
+	}
+
+	fmt.Fprintf(buf, "  esac\n")
+	fmt.Fprintf(buf, "}\n\n")
+
+	fmt.Fprintf(buf, `%[1]s_callback() {
+  local line
+  COMPREPLY=()
+
+  while IFS= read -r line; do
+    COMPREPLY+=("${line%%%%$'\t'*}")
+  done < <("${COMP_WORDS[0]}" %[2]s "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null)
+
+  if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+    compopt -o nospace 2>/dev/null
+  fi
+}
+
+`, fn, CompletionCommandName)
+
+	fmt.Fprintf(buf, `%[1]s() {
+  local cur word path skip i words
+  cur="${COMP_WORDS[COMP_CWORD]}"
+  path=""
+  skip=0
+
+  for ((i = 1; i < COMP_CWORD; i++)); do
+    word="${COMP_WORDS[i]}"
+
+    if [[ $skip -eq 1 ]]; then
+      skip=0
+    elif [[ $word == -* ]]; then
+      if [[ " $(%[1]s_value_options "$path") " == *" $word "* ]]; then
+        skip=1
+      fi
+    elif [[ " $(%[1]s_commands "$path") " == *" $word "* ]]; then
+      path="${path:+$path }$word"
+    fi
+  done
+
+  if [[ $skip -eq 1 ]]; then
+    words="$(%[1]s_choices "$path" "${COMP_WORDS[COMP_CWORD-1]}")"
+    if [[ -n $words ]]; then
+      COMPREPLY=($(compgen -W "$words" -- "$cur"))
+    else
+      %[1]s_callback
+    fi
+  elif [[ $cur == -* ]]; then
+    COMPREPLY=($(compgen -W "$(%[1]s_options "$path")" -- "$cur"))
+  else
+    words="$(%[1]s_commands "$path")"
+    if [[ -n $words ]]; then
+      COMPREPLY=($(compgen -W "$words" -- "$cur"))
+    else
+      %[1]s_callback
+    fi
+  fi
+}
+
+complete -F %[1]s %[2]s
+`, fn, p.Name)
+}
+
+func (p *Program) writeZshCompletion(buf *bytes.Buffer) {
+	fn := p.completionFunctionName()
+	scopes := p.completionScopes()
+
+	writeCase := func(name string, words func(completionScope) []string) {
+		fmt.Fprintf(buf, "%s_%s() {\n", fn, name)
+		fmt.Fprintf(buf, "  reply=()\n")
+		fmt.Fprintf(buf, "  case \"$1\" in\n")
+
+		for _, scope := range scopes {
+			values := words(scope)
+			if len(values) == 0 {
+				continue
+			}
+
+			quotedValues := make([]string, len(values))
+			for i, value := range values {
+				quotedValues[i] = shellQuote(value)
+			}
+
+			fmt.Fprintf(buf, "    %s) reply=(%s) ;;\n",
+				shellQuote(scope.path), strings.Join(quotedValues, " "))
+		}
+
+		fmt.Fprintf(buf, "  esac\n")
+		fmt.Fprintf(buf, "}\n\n")
+	}
+
+	fmt.Fprintf(buf, "#compdef %s\n\n", p.Name)
+
+	// Entries used with _describe are "<name>:<description>" strings.
+
+	writeCase("commands", func(scope completionScope) []string {
+		var entries []string
+		for _, c := range scope.commands {
+			entries = append(entries, c.Name+":"+c.Description)
+		}
+
+		return entries
+	})
+
+	writeCase("options", func(scope completionScope) []string {
+		var entries []string
+		for _, opt := range scope.options {
+			for _, name := range opt.completionNames() {
+				entries = append(entries, name+":"+opt.Description)
+			}
+		}
+
+		return entries
+	})
+
+	writeCase("value_options", func(scope completionScope) []string {
+		return valueOptionNames(scope.options)
+	})
+
+	// Option values, including choices, are always completed by the
+	// program so that candidates are described by the value name of the
+	// option.
+
+	fmt.Fprintf(buf, `%[1]s_callback() {
+  local line
+  local -a candidates
+
+  for line in "${(@f)$("${words[1]}" %[2]s "${(@)words[2,CURRENT]}" 2>/dev/null)}"; do
+    [[ -n $line ]] || continue
+    candidates+=("${${line%%%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+  done
+
+  _describe -t values 'value' candidates
+}
+
+`, fn, CompletionCommandName)
+
+	fmt.Fprintf(buf, `%[1]s() {
+  local word path skip i
+  local -a reply
+  path=""
+  skip=0
+
+  for ((i = 2; i < CURRENT; i++)); do
+    word="${words[i]}"
+
+    if (( skip )); then
+      skip=0
+    elif [[ $word == -* ]]; then
+      %[1]s_value_options "$path"
+      if (( ${reply[(Ie)$word]} )); then
+        skip=1
+      fi
+    else
+      %[1]s_commands "$path"
+      if (( ${reply[(I)${(b)word}:*]} )); then
+        path="${path:+$path }$word"
+      fi
+    fi
+  done
+
+  if (( skip )); then
+    %[1]s_callback
+  elif [[ ${words[CURRENT]} == -* ]]; then
+    %[1]s_options "$path"
+    _describe -t options 'option' reply
+  else
+    %[1]s_commands "$path"
+    if (( ${#reply} )); then
+      _describe -t commands 'command' reply
+    else
+      %[1]s_callback
+    fi
+  fi
+}
+
+if [[ "${funcstack[1]}" == %[1]s ]]; then
+  %[1]s "$@"
+else
+  compdef %[1]s %[2]s
+fi
+`, fn, p.Name)
+}
+
+func (p *Program) writeFishCompletion(buf *bytes.Buffer) {
+	fn := "_" + p.completionFunctionName()
+	scopes := p.completionScopes()
+
+	writeSwitch := func(name string, words func(completionScope) []string) {
+		fmt.Fprintf(buf, "function %s_%s\n", fn, name)
+		fmt.Fprintf(buf, "    switch \"$argv[1]\"\n")
+
+		for _, scope := range scopes {
+			values := words(scope)
+			if len(values) == 0 {
+				continue
+			}
+
+			quotedValues := make([]string, len(values))
+			for i, value := range values {
+				quotedValues[i] = fishQuote(value)
+			}
+
+			fmt.Fprintf(buf, "        case %s\n", fishQuote(scope.path))
+			fmt.Fprintf(buf, "            printf '%%s\\n' %s\n",
+				strings.Join(quotedValues, " "))
+		}
+
+		fmt.Fprintf(buf, "    end\n")
+		fmt.Fprintf(buf, "end\n\n")
+	}
+
+	fmt.Fprintf(buf, "# fish completion for %s\n\n", p.Name)
+
+	writeSwitch("commands", func(scope completionScope) []string {
+		return commandNames(scope.commands)
+	})
+
+	writeSwitch("value_options", func(scope completionScope) []string {
+		return valueOptionNames(scope.options)
+	})
+
+	fmt.Fprintf(buf, `function %[1]s_path
+    set -l path ''
+    set -l skip 0
+    set -l words (commandline -opc)
+    set -e words[1]
+
+    for word in $words
+        if test $skip -eq 1
+            set skip 0
+        else if string match -q -- '-*' $word
+            if contains -- $word (%[1]s_value_options $path)
+                set skip 1
+            end
+        else if contains -- $word (%[1]s_commands $path)
+            set path (string trim -- "$path $word")
+        end
+    end
+
+    echo $path
+end
+
+function %[1]s_callback
+    set -l words (commandline -opc)
+    set -l current (commandline -ct)
+    $words[1] %[2]s $words[2..-1] "$current" 2>/dev/null
+end
+
+function %[1]s_using_path
+    set -l path (%[1]s_path)
+    test "$path" = "$argv[1]"
+end
+
+function %[1]s_in_path
+    set -l path (%[1]s_path)
+    test "$path" = "$argv[1]"; or string match -q -- "$argv[1] *" "$path"
+end
+
+`, fn, CompletionCommandName)
+
+	prefix := "complete -c " + p.Name
+	callback := fishQuote("(" + fn + "_callback)")
+
+	for _, scope := range scopes {
+		condition := fishQuote(fn + "_using_path " + fishQuote(scope.path))
+
+		for _, c := range scope.commands {
+			fmt.Fprintf(buf, "%s -f -n %s -a %s -d %s\n", prefix, condition,
+				fishQuote(c.Name), fishQuote(c.Description))
+		}
+
+		if len(scope.commands) == 0 && len(scope.arguments) > 0 {
+			fmt.Fprintf(buf, "%s -f -n %s -a %s\n", prefix, condition,
+				callback)
+		}
+	}
+
+	writeOption := func(opt *Option, condition string) {
+		buf.WriteString(prefix)
+
+		if condition != "" {
+			fmt.Fprintf(buf, " -n %s", condition)
+		}
+
+		if opt.ShortName != "" {
+			fmt.Fprintf(buf, " -s %s", fishQuote(opt.ShortName))
+		}
+
+		if opt.LongName != "" {
+			fmt.Fprintf(buf, " -l %s", fishQuote(opt.LongName))
+		}
+
+		fmt.Fprintf(buf, " -d %s", fishQuote(opt.Description))
+
+		if !opt.isFlag() {
+			if len(opt.Choices) > 0 {
+				fmt.Fprintf(buf, " -r -f -a %s",
+					fishQuote(strings.Join(opt.Choices, " ")))
+			} else {
+				fmt.Fprintf(buf, " -r -f -a %s", callback)
+			}
+		}
+
+		buf.WriteString("\n")
+
+		if opt.negatable() {
+			buf.WriteString(prefix)
+
+			if condition != "" {
+				fmt.Fprintf(buf, " -n %s", condition)
+			}
+
+			fmt.Fprintf(buf, " -l %s -d %s\n", fishQuote("no-"+opt.LongName),
+				fishQuote(opt.Description))
+		}
+	}
+
+	for _, opt := range sortedOptions(p.options) {
+		writeOption(opt, "")
+	}
+
+	p.walkCommands(func(c *Command) {
+		condition := fishQuote(fn + "_in_path " + fishQuote(c.FullName()))
+
+		for _, opt := range sortedOptions(c.options) {
+			writeOption(opt, condition)
+		}
+	})
+}
+
+func (p *Program) writeCompletions(w io.Writer, words []string) error {
+	for _, completion := range p.complete(words) {
+		description := strings.Map(func(c rune) rune {
+			if c == '\t' || c == '\n' {
+				return ' '
+			}
+
+			return c
+		}, completion.Description)
+
+		_, err := fmt.Fprintf(w, "%s\t%s\n", completion.Value, description)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Program) complete(words []string) []Completion {
+	// Words are the arguments of the command line following the program
+	// name, the last one being the word to complete.
+
+	var cur string
+	if len(words) > 0 {
+		cur = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	var command *Command
+	var pendingOption *Option
+	var nbArguments int
+	var optionsDone bool
+
+	for _, word := range words {
+		if pendingOption != nil {
+			pendingOption = nil
+			continue
+		}
+
+		if !optionsDone && word == "--" {
+			optionsDone = true
+			continue
+		}
+
+		if !optionsDone && isOption(word) {
+			pendingOption = p.completionValueOption(command, word)
+			continue
+		}
+
+		if nbArguments == 0 {
+			if c, found := p.completionSubcommands(command)[word]; found {
+				command = c
+				continue
+			}
+		}
+
+		nbArguments++
+	}
+
+	var completions []Completion
+
+	switch {
+	case pendingOption != nil:
+		completions = pendingOption.completeValue(cur)
+		completions = describeCompletions(completions,
+			pendingOption.valueName())
+
+	case !optionsDone && strings.HasPrefix(cur, "--") &&
+		strings.Contains(cur, "="):
+		i := strings.IndexByte(cur, '=')
+		prefix, value := cur[:i+1], cur[i+1:]
+
+		opt := p.findOption(command, cur[2:i])
+		if opt == nil || opt.isFlag() {
+			return nil
+		}
+
+		for _, completion := range opt.completeValue(value) {
+			completion.Value = prefix + completion.Value
+			completions = append(completions, completion)
+		}
+
+		completions = describeCompletions(completions, opt.valueName())
+
+	case !optionsDone && strings.HasPrefix(cur, "-"):
+		for _, opt := range p.scopeOptions(command) {
+			for _, name := range opt.completionNames() {
+				completions = append(completions, Completion{
+					Value:       name,
+					Description: opt.Description,
+				})
+			}
+		}
+
+	default:
+		subcommands := p.completionSubcommands(command)
+
+		if len(subcommands) > 0 {
+			if nbArguments > 0 {
+				return nil
+			}
+
+			for _, c := range visibleCommands(subcommands) {
+				completions = append(completions, Completion{
+					Value:       c.Name,
+					Description: c.Description,
+				})
+			}
+		} else {
+			arg := p.completionArgument(command, nbArguments)
+			if arg == nil {
+				return nil
+			}
+
+			if arg.Complete != nil {
+				completions = arg.Complete(cur)
+			} else {
+				completions = CompleteFiles(cur)
+			}
+
+			completions = describeCompletions(completions, arg.Name)
+		}
+	}
+
+	return filterCompletions(completions, cur)
+}
+
+func (p *Program) completionValueOption(command *Command, word string) *Option {
+	// Return the option whose value is the next word if there is one.
+
+	if strings.HasPrefix(word, "--") {
+		if strings.Contains(word, "=") {
+			return nil
+		}
+
+		opt := p.findOption(command, word[2:])
+		if opt == nil || opt.isFlag() {
+			return nil
+		}
+
+		return opt
+	}
+
+	for i, c := range word[1:] {
+		opt := p.findOption(command, string(c))
+		if opt == nil {
+			return nil
+		}
+
+		if !opt.isFlag() {
+			if 1+i+len(string(c)) < len(word) {
+				return nil
+			}
+
+			return opt
+		}
+	}
+
+	return nil
+}
+
+func (p *Program) completionSubcommands(command *Command) map[string]*Command {
+	if command == nil {
+		return p.commands
+	}
+
+	return command.commands
+}
+
+func (p *Program) completionArgument(command *Command, n int) *Argument {
+	arguments := p.arguments
+	if command != nil {
+		arguments = command.arguments
+	}
+
+	if n < len(arguments) {
+		return arguments[n]
+	}
+
+	if len(arguments) > 0 && arguments[len(arguments)-1].Trailing {
+		return arguments[len(arguments)-1]
+	}
+
+	return nil
+}
+
+func (opt *Option) completeValue(prefix string) []Completion {
+	if len(opt.Choices) > 0 {
+		completions := make([]Completion, len(opt.Choices))
+		for i, choice := range opt.Choices {
+			completions[i] = Completion{Value: choice}
+		}
+
+		return completions
+	}
+
+	if opt.Complete != nil {
+		return opt.Complete(prefix)
+	}
+
+	return CompleteFiles(prefix)
+}
+
+func describeCompletions(completions []Completion, description string) []Completion {
+	// Values without a description are described by the value name of the
+	// option or the name of the argument being completed. Zsh and fish
+	// display descriptions next to candidates; bash cannot display them and
+	// only uses values.
+
+	described := make([]Completion, len(completions))
+
+	for i, completion := range completions {
+		if completion.Description == "" {
+			completion.Description = description
+		}
+
+		described[i] = completion
+	}
+
+	return described
+}
+
+func filterCompletions(completions []Completion, prefix string) []Completion {
+	var filtered []Completion
+
+	for _, completion := range completions {
+		if strings.HasPrefix(completion.Value, prefix) {
+			filtered = append(filtered, completion)
+		}
+	}
+
+	return filtered
+}
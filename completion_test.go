@@ -0,0 +1,161 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCompletionScript(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+	p.AddChoiceOption("", "format", "format", "text",
+		[]string{"text", "json"}, "the output format")
+	p.addDefaultCommands()
+
+	var buf bytes.Buffer
+
+	require.NoError(p.WriteCompletionScript(&buf, "bash"))
+	script := buf.String()
+	assert.Contains(script, "complete -F _test_completion test")
+	assert.Contains(script, "'') echo 'bar completion foo help' ;;")
+	assert.Contains(script, "'foo') echo '-b -c --option-c --debug "+
+		"--flag-a --no-flag-a --format -h --help -q --quiet --no-quiet "+
+		"-d --flag-d --no-flag-d' ;;")
+	assert.Contains(script, "'|--format') echo 'text json' ;;")
+
+	buf.Reset()
+	require.NoError(p.WriteCompletionScript(&buf, "zsh"))
+	script = buf.String()
+	assert.Contains(script, "#compdef test")
+	assert.Contains(script, "'foo:foo command'")
+	assert.NotContains(script, "_choices")
+
+	buf.Reset()
+	require.NoError(p.WriteCompletionScript(&buf, "fish"))
+	script = buf.String()
+	assert.Contains(script, "complete -c test -l 'format' "+
+		"-d 'the output format' -r -f -a 'text json'")
+
+	assert.Error(p.WriteCompletionScript(&buf, "tcsh"))
+}
+
+func TestComplete(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestProgram()
+	p.AddChoiceOption("", "format", "format", "text",
+		[]string{"text", "json"}, "the output format")
+	p.commands["foo"].arguments[0].Complete = func(string) []Completion {
+		return []Completion{
+			{Value: "alpha", Description: "the first cluster"},
+			{Value: "beta", Description: "the second cluster"},
+		}
+	}
+	p.addDefaultCommands()
+
+	values := func(words ...string) []string {
+		var values []string
+		for _, completion := range p.complete(words) {
+			values = append(values, completion.Value)
+		}
+
+		return values
+	}
+
+	assert.Equal([]string{"bar", "completion", "foo", "help"}, values(""))
+	assert.Equal([]string{"foo"}, values("f"))
+	assert.Equal([]string{"--flag-a", "--flag-d"}, values("foo", "--fl"))
+	assert.Equal([]string{"json"}, values("--format", "j"))
+	assert.Equal([]string{"--format=text"}, values("--format=t"))
+	assert.Equal([]string{"alpha", "beta"}, values("-c", "x", "foo", ""))
+	assert.Equal([]string{"beta"}, values("foo", "-d", "b"))
+	assert.Equal([]string{"fish"}, values("completion", "f"))
+	assert.Empty(values("foo", "--", "-"))
+
+	completions := p.complete([]string{"foo", "a"})
+	assert.Equal([]Completion{{"alpha", "the first cluster"}}, completions)
+
+	completions = p.complete([]string{"--format", "j"})
+	assert.Equal([]Completion{{"json", "format"}}, completions)
+
+	completions = p.complete([]string{"--format=j"})
+	assert.Equal([]Completion{{"--format=json", "format"}}, completions)
+
+	p.commands["bar"].arguments[0].Complete = func(string) []Completion {
+		return []Completion{{Value: "a1"}}
+	}
+
+	completions = p.complete([]string{"bar", ""})
+	assert.Equal([]Completion{{"a1", "arg-opt"}}, completions)
+}
+
+func TestCompleteFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "")
+	writeTestFile(t, filepath.Join(dir, "b", "c.txt"), "")
+	writeTestFile(t, filepath.Join(dir, ".hidden"), "")
+
+	assert.Equal([]Completion{{Value: dir + "/a.txt"}, {Value: dir + "/b/"}},
+		CompleteFiles(dir+"/"))
+	assert.Equal([]Completion{{Value: dir + "/.hidden"}},
+		CompleteFiles(dir+"/."))
+	assert.Equal([]Completion{{Value: dir + "/b/"}},
+		CompleteDirectories(dir+"/"))
+}
+
+func TestCompletionCommandWithRequiredOption(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	writeTestFile(t, filepath.Join(dir, "test", "config.json"), "{")
+
+	p := newTestProgram()
+	p.EnableConfigFile()
+	p.AddOption("", "token", "token", "", "").Required = true
+	p.AddOptionConstraint(OptionConstraintExactlyOneOf, "flag-a", "b")
+
+	assert.NoError(p.ParseArgs([]string{"completion", "bash"}))
+	assert.Equal("completion", p.CommandName())
+
+	var missingErr *MissingOptionsError
+	assert.ErrorAs(p.ParseArgs([]string{"bar"}), new(*ConfigFileError))
+	assert.NoError(os.Remove(filepath.Join(dir, "test", "config.json")))
+	assert.ErrorAs(p.ParseArgs([]string{"bar"}), &missingErr)
+}
+
+func TestCompletionCommandDefinedByProgram(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestProgram()
+	c := p.AddCommand("completion", "complete things", func(*Program) {})
+
+	assert.NoError(p.ParseArgs([]string{"completion"}))
+	assert.Same(c, p.commands["completion"])
+	assert.False(c.builtin)
+	assert.True(p.commands["help"].builtin)
+}
@@ -0,0 +1,437 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Configuration decoders return the content of a configuration file as a
+// tree of values. Objects are represented as map[string]ConfigValue, arrays
+// as []ConfigValue, and scalars as strings, booleans, numbers or nil. Line
+// numbers are optional and only used in error messages.
+type ConfigDecoder func([]byte) (map[string]ConfigValue, error)
+
+type ConfigValue struct {
+	Value interface{}
+	Line  int
+}
+
+func (p *Program) EnableConfigFile() {
+	if p.configDecoders != nil {
+		return
+	}
+
+	p.configDecoders = map[string]ConfigDecoder{
+		"json": DecodeJSONConfig,
+	}
+
+	p.AddOption("", "config", "path", "", "the path of the configuration file")
+}
+
+func (p *Program) AddConfigDecoder(extension string, decoder ConfigDecoder) {
+	p.EnableConfigFile()
+	p.configDecoders[extension] = decoder
+}
+
+func (p *Program) ConfigFilePath() string {
+	return p.configPath
+}
+
+func (p *Program) configFileExtensions() []string {
+	extensions := make([]string, 0, len(p.configDecoders))
+	for extension := range p.configDecoders {
+		extensions = append(extensions, extension)
+	}
+
+	sort.Strings(extensions)
+
+	return extensions
+}
+
+func (p *Program) findConfigFile() (string, error) {
+	// See the XDG Base Directory Specification.
+
+	var dirs []string
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(homeDir, ".config")
+		}
+	}
+
+	if configHome != "" {
+		dirs = append(dirs, configHome)
+	}
+
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+
+	for _, dir := range filepath.SplitList(configDirs) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for _, dir := range dirs {
+		for _, extension := range p.configFileExtensions() {
+			path := filepath.Join(dir, p.Name, "config."+extension)
+
+			_, err := os.Stat(path)
+			if err == nil {
+				return path, nil
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func (p *Program) loadConfigFile() error {
+	p.configPath = ""
+
+	if p.configDecoders == nil {
+		return nil
+	}
+
+	var path string
+
+	if p.IsOptionSet("config") {
+		path = p.OptionValue("config")
+	} else {
+		var err error
+
+		path, err = p.findConfigFile()
+		if err != nil {
+			return fmt.Errorf("cannot find configuration file: %w", err)
+		}
+
+		if path == "" {
+			return nil
+		}
+	}
+
+	extension := filepath.Ext(path)
+	if extension != "" {
+		extension = extension[1:]
+	}
+
+	decoder, found := p.configDecoders[extension]
+	if !found {
+		return &ConfigFileError{
+			Path: path,
+			Err:  fmt.Errorf("unsupported configuration file format"),
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read configuration file: %w", err)
+	}
+
+	values, err := decoder(data)
+	if err != nil {
+		return &ConfigFileError{Path: path, Err: err}
+	}
+
+	p.configPath = path
+
+	// Options set on the command line or in the environment have precedence
+	// over the configuration file.
+	preset := make(map[*Option]bool)
+	for _, opt := range p.activeOptions() {
+		preset[opt] = opt.Set || opt.Negated
+	}
+
+	return p.applyConfigSection(nil, values, preset)
+}
+
+func (p *Program) applyConfigSection(command *Command, values map[string]ConfigValue, preset map[*Option]bool) error {
+	// Top-level keys are either global options or command names; command
+	// sections contain command options and subcommand sections.
+
+	options := p.options
+	commands := p.commands
+
+	if command != nil {
+		options = command.options
+		commands = command.commands
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := values[key]
+
+		if opt, found := options[key]; found {
+			if isPreset, active := preset[opt]; !active || isPreset {
+				continue
+			}
+
+			if err := opt.setConfigValue(value); err != nil {
+				return &ConfigFileError{
+					Path: p.configPath,
+					Line: value.Line,
+					Err:  fmt.Errorf("invalid value for option %q: %w", key, err),
+				}
+			}
+
+			opt.source = OptionSource{
+				Type: OptionSourceConfigFile,
+				Path: p.configPath,
+				Line: value.Line,
+			}
+
+			continue
+		}
+
+		if c, found := commands[key]; found {
+			section, ok := value.Value.(map[string]ConfigValue)
+			if !ok {
+				return &ConfigFileError{
+					Path: p.configPath,
+					Line: value.Line,
+					Err:  fmt.Errorf("command section %q is not an object", key),
+				}
+			}
+
+			if err := p.applyConfigSection(c, section, preset); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		return &ConfigFileError{
+			Path: p.configPath,
+			Line: value.Line,
+			Err:  fmt.Errorf("unknown key %q", key),
+		}
+	}
+
+	return nil
+}
+
+func (opt *Option) setConfigValue(value ConfigValue) error {
+	switch v := value.Value.(type) {
+	case nil:
+		return nil
+
+	case []ConfigValue:
+		if !opt.Repeatable {
+			return fmt.Errorf("option does not accept multiple values")
+		}
+
+		for _, element := range v {
+			s, ok := configScalar(element.Value)
+			if !ok {
+				return fmt.Errorf("invalid array element")
+			}
+
+			if err := opt.setExternalValue(s); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case map[string]ConfigValue:
+		if opt.Type != OptionTypeMap {
+			return fmt.Errorf("option does not accept objects")
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s, ok := configScalar(v[key].Value)
+			if !ok {
+				return fmt.Errorf("invalid value for key %q", key)
+			}
+
+			if err := opt.setValue(key + "=" + s); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	s, _ := configScalar(value.Value)
+	return opt.setExternalValue(s)
+}
+
+func configScalar(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case []ConfigValue, map[string]ConfigValue:
+		return "", false
+	}
+
+	return fmt.Sprint(value), true
+}
+
+func DecodeJSONConfig(data []byte) (map[string]ConfigValue, error) {
+	d := jsonConfigDecoder{
+		data:    data,
+		decoder: json.NewDecoder(bytes.NewReader(data)),
+	}
+
+	d.decoder.UseNumber()
+
+	value, err := d.decodeValue()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := d.decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid data after top-level value")
+	}
+
+	values, ok := value.Value.(map[string]ConfigValue)
+	if !ok {
+		return nil, fmt.Errorf("top-level value is not an object")
+	}
+
+	return values, nil
+}
+
+type jsonConfigDecoder struct {
+	data    []byte
+	decoder *json.Decoder
+}
+
+func (d *jsonConfigDecoder) line() int {
+	// Return the line of the next token.
+
+	offset := int(d.decoder.InputOffset())
+
+	for offset < len(d.data) {
+		switch d.data[offset] {
+		case ' ', '\t', '\r', '\n', ':', ',':
+			offset++
+			continue
+		}
+
+		break
+	}
+
+	return 1 + bytes.Count(d.data[:offset], []byte{'\n'})
+}
+
+func (d *jsonConfigDecoder) decodeValue() (ConfigValue, error) {
+	line := d.line()
+
+	token, err := d.decoder.Token()
+	if err != nil {
+		return ConfigValue{}, fmt.Errorf("line %d: %w", line, err)
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '{' {
+			return d.decodeObject(line)
+		} else if t == '[' {
+			return d.decodeArray(line)
+		}
+
+		return ConfigValue{}, fmt.Errorf("line %d: unexpected delimiter %q",
+			line, t)
+
+	case json.Number:
+		return ConfigValue{Value: t.String(), Line: line}, nil
+	}
+
+	return ConfigValue{Value: token, Line: line}, nil
+}
+
+func (d *jsonConfigDecoder) decodeObject(line int) (ConfigValue, error) {
+	values := make(map[string]ConfigValue)
+
+	for d.decoder.More() {
+		keyLine := d.line()
+
+		token, err := d.decoder.Token()
+		if err != nil {
+			return ConfigValue{}, fmt.Errorf("line %d: %w", keyLine, err)
+		}
+
+		key := token.(string)
+		if _, found := values[key]; found {
+			return ConfigValue{}, fmt.Errorf("line %d: duplicate key %q",
+				keyLine, key)
+		}
+
+		value, err := d.decodeValue()
+		if err != nil {
+			return ConfigValue{}, err
+		}
+
+		values[key] = value
+	}
+
+	if _, err := d.decoder.Token(); err != nil {
+		return ConfigValue{}, fmt.Errorf("line %d: %w", d.line(), err)
+	}
+
+	return ConfigValue{Value: values, Line: line}, nil
+}
+
+func (d *jsonConfigDecoder) decodeArray(line int) (ConfigValue, error) {
+	var values []ConfigValue
+
+	for d.decoder.More() {
+		value, err := d.decodeValue()
+		if err != nil {
+			return ConfigValue{}, err
+		}
+
+		values = append(values, value)
+	}
+
+	if _, err := d.decoder.Token(); err != nil {
+		return ConfigValue{}, fmt.Errorf("line %d: %w", d.line(), err)
+	}
+
+	return ConfigValue{Value: values, Line: line}, nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("XDG_CONFIG_DIRS", filepath.Join(dir, "none"))
+
+	p := newTestProgram()
+	p.Name = "my-tool"
+	p.EnableConfigFile()
+	p.AddOption("", "tag", "tag", "", "").Repeatable = true
+	p.SetDebugFlag("v", "verbose", "")
+
+	writeTestFile(t, filepath.Join(dir, "my-tool", "config.json"), `{
+  "option-c": "config",
+  "flag-a": true,
+  "verbose": 2,
+  "tag": ["a", "b"],
+  "foo": {
+    "flag-d": true
+  }
+}`)
+
+	err := p.ParseArgs([]string{"foo", "1", "2"})
+	require.NoError(err)
+	assert.Equal(filepath.Join(dir, "my-tool", "config.json"),
+		p.ConfigFilePath())
+	assert.Equal("config", p.OptionValue("option-c"))
+	assert.True(p.IsOptionSet("flag-a"))
+	assert.Equal([]string{"a", "b"}, p.OptionValues("tag"))
+	assert.True(p.IsOptionSet("flag-d"))
+	assert.Equal(2, p.DebugLevel)
+
+	err = p.ParseArgs([]string{"-c", "cli", "bar"})
+	require.NoError(err)
+	assert.Equal("cli", p.OptionValue("option-c"))
+
+	path := filepath.Join(dir, "other.json")
+	writeTestFile(t, path, `{
+  "option-c": "other",
+  "unknown": 42
+}`)
+
+	err = p.ParseArgs([]string{"--config", path, "bar"})
+	var configErr *ConfigFileError
+	if assert.ErrorAs(err, &configErr) {
+		assert.Equal(path, configErr.Path)
+		assert.Equal(3, configErr.Line)
+	}
+
+	err = p.ParseArgs([]string{"--config", filepath.Join(dir, "missing.json"),
+		"bar"})
+	assert.ErrorIs(err, os.ErrNotExist)
+}
+
+func TestDecodeJSONConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	values, err := DecodeJSONConfig([]byte(`{"a": 1.5, "b": [true, null]}`))
+	require.NoError(err)
+	assert.Equal(ConfigValue{Value: "1.5", Line: 1}, values["a"])
+
+	_, err = DecodeJSONConfig([]byte("{\n\"a\": 1,\n\"a\": 2}"))
+	assert.EqualError(err, `line 3: duplicate key "a"`)
+
+	_, err = DecodeJSONConfig([]byte(`[]`))
+	assert.Error(err)
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Program definitions describe the command line interface of a program, but
+// not its state. They are serialized in a stable way: the order of commands,
+// options and arguments does not depend on map iteration, and fields only
+// ever get added.
+type ProgramDefinition struct {
+	Name        string                       `json:"name"`
+	Description string                       `json:"description,omitempty"`
+	BuildId     string                       `json:"build_id,omitempty"`
+	Options     []OptionDefinition           `json:"options,omitempty"`
+	Arguments   []ArgumentDefinition         `json:"arguments,omitempty"`
+	Constraints []OptionConstraintDefinition `json:"constraints,omitempty"`
+	Commands    []CommandDefinition          `json:"commands,omitempty"`
+}
+
+type CommandDefinition struct {
+	Name        string                       `json:"name"`
+	Description string                       `json:"description,omitempty"`
+	Hidden      bool                         `json:"hidden,omitempty"`
+	Options     []OptionDefinition           `json:"options,omitempty"`
+	Arguments   []ArgumentDefinition         `json:"arguments,omitempty"`
+	Constraints []OptionConstraintDefinition `json:"constraints,omitempty"`
+	Commands    []CommandDefinition          `json:"commands,omitempty"`
+}
+
+type OptionDefinition struct {
+	ShortName           string   `json:"short_name,omitempty"`
+	LongName            string   `json:"long_name,omitempty"`
+	ValueName           string   `json:"value_name,omitempty"`
+	DefaultValue        string   `json:"default_value,omitempty"`
+	Description         string   `json:"description,omitempty"`
+	Flag                bool     `json:"flag,omitempty"`
+	Type                string   `json:"type,omitempty"`
+	Repeatable          bool     `json:"repeatable,omitempty"`
+	Counted             bool     `json:"counted,omitempty"`
+	Negatable           bool     `json:"negatable,omitempty"`
+	Required            bool     `json:"required,omitempty"`
+	Secret              bool     `json:"secret,omitempty"`
+	Choices             []string `json:"choices,omitempty"`
+	EnvironmentVariable string   `json:"environment_variable,omitempty"`
+}
+
+type ArgumentDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Optional    bool   `json:"optional,omitempty"`
+	Trailing    bool   `json:"trailing,omitempty"`
+}
+
+type OptionConstraintDefinition struct {
+	Type    string   `json:"type"`
+	Options []string `json:"options"`
+}
+
+// The definition flag is handled by ParseCommandLine before parsing the
+// command line, see ManPageFlagName.
+const DefinitionFlagName = "--cli-definition"
+
+func (p *Program) EnableDefinitionFlag() {
+	p.definitionFlag = true
+}
+
+func (p *Program) WriteDefinition(w io.Writer) error {
+	data, err := json.MarshalIndent(p.Definition(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode definition: %w", err)
+	}
+
+	data = append(data, '\n')
+
+	_, err = w.Write(data)
+	return err
+}
+
+func (p *Program) Definition() *ProgramDefinition {
+	def := ProgramDefinition{
+		Name:        p.Name,
+		Description: p.Description,
+		Options:     p.optionDefinitions(p.options),
+		Arguments:   argumentDefinitions(p.arguments),
+		Constraints: optionConstraintDefinitions(p.constraints),
+		Commands:    p.commandDefinitions(p.commands),
+	}
+
+	if p.BuildId != nil {
+		def.BuildId = p.BuildId.String()
+	}
+
+	return &def
+}
+
+func (p *Program) commandDefinitions(commands map[string]*Command) []CommandDefinition {
+	var defs []CommandDefinition
+
+	for _, c := range sortedCommands(commands) {
+		// Built-in commands are only added when parsing; they are always
+		// left out so that the definition does not depend on it.
+		if c.builtin {
+			continue
+		}
+
+		defs = append(defs, CommandDefinition{
+			Name:        c.Name,
+			Description: c.Description,
+			Hidden:      c.Hidden,
+			Options:     p.optionDefinitions(c.options),
+			Arguments:   argumentDefinitions(c.arguments),
+			Constraints: optionConstraintDefinitions(c.constraints),
+			Commands:    p.commandDefinitions(c.commands),
+		})
+	}
+
+	return defs
+}
+
+func (p *Program) optionDefinitions(options map[string]*Option) []OptionDefinition {
+	var defs []OptionDefinition
+
+	for _, opt := range sortedOptions(options) {
+		def := OptionDefinition{
+			ShortName:           opt.ShortName,
+			LongName:            opt.LongName,
+			ValueName:           opt.valueName(),
+			DefaultValue:        opt.DefaultValue,
+			Description:         opt.Description,
+			Flag:                opt.isFlag(),
+			Type:                string(opt.Type),
+			Repeatable:          opt.Repeatable,
+			Counted:             opt.Counted,
+			Negatable:           opt.negatable(),
+			Required:            opt.Required,
+			Secret:              opt.Secret,
+			Choices:             opt.Choices,
+			EnvironmentVariable: p.optionEnvironmentVariable(opt),
+		}
+
+		if opt.Secret {
+			def.DefaultValue = ""
+		}
+
+		defs = append(defs, def)
+	}
+
+	return defs
+}
+
+func argumentDefinitions(arguments []*Argument) []ArgumentDefinition {
+	var defs []ArgumentDefinition
+
+	for _, arg := range arguments {
+		defs = append(defs, ArgumentDefinition{
+			Name:        arg.Name,
+			Description: arg.Description,
+			Optional:    arg.Optional,
+			Trailing:    arg.Trailing,
+		})
+	}
+
+	return defs
+}
+
+func optionConstraintDefinitions(constraints []*OptionConstraint) []OptionConstraintDefinition {
+	var defs []OptionConstraintDefinition
+
+	for _, c := range constraints {
+		defs = append(defs, OptionConstraintDefinition{
+			Type:    c.Type.String(),
+			Options: c.Options,
+		})
+	}
+
+	return defs
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefinition(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+	p.BuildId = &BuildId{Major: 1, Minor: 2, Patch: 3}
+	p.AddOption("", "token", "token", "secret", "").Secret = true
+	p.AddOptionConstraint(OptionConstraintAtMostOneOf, "flag-a", "b")
+	p.AddTypedOption(OptionTypeDuration, "", "timeout", "", "", "")
+	p.AddCountedFlag("", "verbose", "")
+	p.AddCommand("secret", "a hidden command", func(*Program) {}).Hidden =
+		true
+
+	def := p.Definition()
+	assert.Equal("test", def.Name)
+	assert.Equal("v1.2.3", def.BuildId)
+	assert.Equal(OptionDefinition{
+		ShortName:    "c",
+		LongName:     "option-c",
+		ValueName:    "value",
+		DefaultValue: "foo",
+		Description:  "an option",
+	}, def.Options[1])
+	assert.Equal([]OptionConstraintDefinition{
+		{Type: "at_most_one_of", Options: []string{"flag-a", "b"}},
+	}, def.Constraints)
+
+	var names []string
+	for _, c := range def.Commands {
+		names = append(names, c.Name)
+	}
+
+	assert.Equal([]string{"bar", "foo", "secret"}, names)
+	assert.True(def.Commands[2].Hidden)
+	assert.Equal(ArgumentDefinition{Name: "arg-3",
+		Description: "all trailing arguments", Trailing: true},
+		def.Commands[1].Arguments[2])
+
+	p.addDefaultCommands()
+	assert.Equal(def, p.Definition())
+
+	for _, opt := range def.Options {
+		switch opt.LongName {
+		case "token":
+			assert.True(opt.Secret)
+			assert.Empty(opt.DefaultValue)
+		case "timeout":
+			assert.Equal("duration", opt.ValueName)
+		case "verbose":
+			assert.True(opt.Counted)
+			assert.False(opt.Repeatable)
+		}
+	}
+
+	var buf1, buf2 bytes.Buffer
+	require.NoError(p.WriteDefinition(&buf1))
+	require.NoError(p.WriteDefinition(&buf2))
+	assert.Equal(buf1.String(), buf2.String())
+
+	var decodedDef ProgramDefinition
+	require.NoError(json.Unmarshal(buf1.Bytes(), &decodedDef))
+	assert.Equal(*def, decodedDef)
+}
+
+func TestDefinitionFlag(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var buf bytes.Buffer
+
+	p := NewProgram("test", "a test program")
+	p.AddOption("", "token", "token", "", "").Required = true
+	p.SetMain(func(*Program) {})
+	p.EnableDefinitionFlag()
+
+	handled, err := p.handleBuiltinArgs(&buf, []string{DefinitionFlagName})
+	require.NoError(err)
+	assert.True(handled)
+
+	var def ProgramDefinition
+	require.NoError(json.Unmarshal(buf.Bytes(), &def))
+	assert.Equal("test", def.Name)
+	assert.Empty(def.Commands)
+}
@@ -0,0 +1,326 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type DocumentationFormat string
+
+const (
+	DocumentationFormatMarkdown DocumentationFormat = "markdown"
+	DocumentationFormatHTML     DocumentationFormat = "html"
+)
+
+func (f DocumentationFormat) extension() string {
+	switch f {
+	case DocumentationFormatMarkdown:
+		return "md"
+	case DocumentationFormatHTML:
+		return "html"
+	}
+
+	return ""
+}
+
+// Documentation pages contain the same information as the output of
+// PrintUsage; each command has its own page, linking to the pages of its
+// parent and subcommands.
+type docPage struct {
+	command     *Command
+	title       string
+	description string
+	synopsis    string
+	parent      *Command
+	commands    []*Command
+	arguments   []*Argument
+	options     []optionGroup
+	constraints []*OptionConstraint
+}
+
+func (p *Program) WriteDocumentation(dir string, format DocumentationFormat) error {
+	extension := format.extension()
+	if extension == "" {
+		return fmt.Errorf("unknown documentation format %q", format)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("cannot create directory %q: %w", dir, err)
+	}
+
+	commands := []*Command{nil}
+	p.walkCommands(func(c *Command) {
+		if !c.isHidden() {
+			commands = append(commands, c)
+		}
+	})
+
+	for _, command := range commands {
+		var buf bytes.Buffer
+
+		if err := p.WriteDocumentationPage(&buf, command, format); err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, p.ManPageName(command)+"."+extension)
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("cannot write %q: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Program) WriteDocumentationPage(w io.Writer, command *Command, format DocumentationFormat) error {
+	var buf bytes.Buffer
+
+	page := p.docPage(command)
+
+	switch format {
+	case DocumentationFormatMarkdown:
+		p.writeMarkdownPage(&buf, page)
+	case DocumentationFormatHTML:
+		p.writeHTMLPage(&buf, page)
+	default:
+		return fmt.Errorf("unknown documentation format %q", format)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (c *Command) isHidden() bool {
+	for ; c != nil; c = c.parent {
+		if c.Hidden {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Program) docPage(command *Command) *docPage {
+	page := docPage{
+		command:     command,
+		title:       p.docPageTitle(command),
+		description: p.Description,
+		commands:    visibleCommands(p.commands),
+		arguments:   p.arguments,
+		options:     p.optionGroups(command),
+		constraints: p.activeConstraints(command),
+	}
+
+	commands := p.commands
+
+	if command != nil {
+		page.description = command.Description
+		page.parent = command.parent
+		page.commands = visibleCommands(command.commands)
+		page.arguments = command.arguments
+
+		commands = command.commands
+	}
+
+	page.synopsis = page.title + " " + usageSynopsis(commands, page.arguments)
+
+	return &page
+}
+
+func (p *Program) docPageLink(command *Command, format DocumentationFormat) string {
+	return p.ManPageName(command) + "." + format.extension()
+}
+
+func (p *Program) docPageTitle(command *Command) string {
+	if command == nil {
+		return p.Name
+	}
+
+	return p.Name + " " + command.FullName()
+}
+
+func (p *Program) writeMarkdownPage(buf *bytes.Buffer, page *docPage) {
+	format := DocumentationFormatMarkdown
+
+	fmt.Fprintf(buf, "# %s\n", markdownEscape(page.title))
+
+	if page.command != nil {
+		fmt.Fprintf(buf, "\nParent: [%s](%s)\n",
+			markdownEscape(p.docPageTitle(page.parent)),
+			p.docPageLink(page.parent, format))
+	}
+
+	if page.description != "" {
+		fmt.Fprintf(buf, "\n%s\n", markdownEscape(sentence(page.description)))
+	}
+
+	fmt.Fprintf(buf, "\n## Usage\n\n```\n%s\n```\n", page.synopsis)
+
+	if len(page.commands) > 0 {
+		fmt.Fprintf(buf, "\n## Commands\n\n")
+		fmt.Fprintf(buf, "| Command | Description |\n")
+		fmt.Fprintf(buf, "|---------|-------------|\n")
+
+		for _, c := range page.commands {
+			fmt.Fprintf(buf, "| [%s](%s) | %s |\n",
+				markdownEscape(c.Name), p.docPageLink(c, format),
+				markdownEscape(sentence(c.Description)))
+		}
+	} else if len(page.arguments) > 0 {
+		fmt.Fprintf(buf, "\n## Arguments\n\n")
+		fmt.Fprintf(buf, "| Argument | Description |\n")
+		fmt.Fprintf(buf, "|----------|-------------|\n")
+
+		for _, arg := range page.arguments {
+			fmt.Fprintf(buf, "| `<%s>` | %s |\n", arg.Name,
+				markdownEscape(sentence(arg.Description)))
+		}
+	}
+
+	for _, group := range page.options {
+		fmt.Fprintf(buf, "\n## %s\n\n", docHeading(group.label))
+		fmt.Fprintf(buf, "| Option | Description |\n")
+		fmt.Fprintf(buf, "|--------|-------------|\n")
+
+		for _, opt := range sortedOptions(group.options) {
+			fmt.Fprintf(buf, "| `%s` | %s |\n",
+				strings.ReplaceAll(opt.usage(), "|", `\|`),
+				markdownEscape(p.docOptionDescription(opt)))
+		}
+	}
+
+	if len(page.constraints) > 0 {
+		fmt.Fprintf(buf, "\n## Option constraints\n\n")
+
+		for _, constraint := range page.constraints {
+			fmt.Fprintf(buf, "- %s\n", markdownEscape(constraint.usage()))
+		}
+	}
+}
+
+func (p *Program) writeHTMLPage(buf *bytes.Buffer, page *docPage) {
+	format := DocumentationFormatHTML
+	e := html.EscapeString
+
+	fmt.Fprintf(buf, "<!DOCTYPE html>\n")
+	fmt.Fprintf(buf, "<html>\n")
+	fmt.Fprintf(buf, "<head>\n")
+	fmt.Fprintf(buf, "<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(buf, "<title>%s</title>\n", e(page.title))
+	fmt.Fprintf(buf, "</head>\n")
+	fmt.Fprintf(buf, "<body>\n")
+
+	fmt.Fprintf(buf, "<h1>%s</h1>\n", e(page.title))
+
+	if page.command != nil {
+		fmt.Fprintf(buf, "<p>Parent: <a href=\"%s\">%s</a></p>\n",
+			e(p.docPageLink(page.parent, format)),
+			e(p.docPageTitle(page.parent)))
+	}
+
+	if page.description != "" {
+		fmt.Fprintf(buf, "<p>%s</p>\n", e(sentence(page.description)))
+	}
+
+	fmt.Fprintf(buf, "<h2>Usage</h2>\n")
+	fmt.Fprintf(buf, "<pre>%s</pre>\n", e(page.synopsis))
+
+	if len(page.commands) > 0 {
+		fmt.Fprintf(buf, "<h2>Commands</h2>\n")
+		fmt.Fprintf(buf, "<dl>\n")
+
+		for _, c := range page.commands {
+			fmt.Fprintf(buf, "<dt><a href=\"%s\">%s</a></dt>\n",
+				e(p.docPageLink(c, format)), e(c.Name))
+			fmt.Fprintf(buf, "<dd>%s</dd>\n", e(sentence(c.Description)))
+		}
+
+		fmt.Fprintf(buf, "</dl>\n")
+	} else if len(page.arguments) > 0 {
+		fmt.Fprintf(buf, "<h2>Arguments</h2>\n")
+		fmt.Fprintf(buf, "<dl>\n")
+
+		for _, arg := range page.arguments {
+			fmt.Fprintf(buf, "<dt><code>&lt;%s&gt;</code></dt>\n", e(arg.Name))
+			fmt.Fprintf(buf, "<dd>%s</dd>\n", e(sentence(arg.Description)))
+		}
+
+		fmt.Fprintf(buf, "</dl>\n")
+	}
+
+	for _, group := range page.options {
+		fmt.Fprintf(buf, "<h2>%s</h2>\n",
+			e(docHeading(group.label)))
+		fmt.Fprintf(buf, "<dl>\n")
+
+		for _, opt := range sortedOptions(group.options) {
+			fmt.Fprintf(buf, "<dt><code>%s</code></dt>\n", e(opt.usage()))
+			fmt.Fprintf(buf, "<dd>%s</dd>\n", e(p.docOptionDescription(opt)))
+		}
+
+		fmt.Fprintf(buf, "</dl>\n")
+	}
+
+	if len(page.constraints) > 0 {
+		fmt.Fprintf(buf, "<h2>Option constraints</h2>\n")
+		fmt.Fprintf(buf, "<ul>\n")
+
+		for _, constraint := range page.constraints {
+			fmt.Fprintf(buf, "<li>%s</li>\n", e(constraint.usage()))
+		}
+
+		fmt.Fprintf(buf, "</ul>\n")
+	}
+
+	fmt.Fprintf(buf, "</body>\n")
+	fmt.Fprintf(buf, "</html>\n")
+}
+
+func (p *Program) docOptionDescription(opt *Option) string {
+	description := sentence(opt.Description)
+
+	for _, note := range p.optionNotes(opt) {
+		description += " (" + note + ")"
+	}
+
+	return description
+}
+
+func docHeading(label string) string {
+	// "GLOBAL OPTIONS" -> "Global options"
+	s := strings.ToLower(label)
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func markdownEscape(s string) string {
+	var buf strings.Builder
+
+	for _, c := range s {
+		if strings.ContainsRune("\\`*_[]<>#|", c) {
+			buf.WriteByte('\\')
+		}
+
+		buf.WriteRune(c)
+	}
+
+	return buf.String()
+}
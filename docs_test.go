@@ -0,0 +1,84 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteDocumentationPage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+	p.addDefaultCommands()
+
+	var buf bytes.Buffer
+
+	err := p.WriteDocumentationPage(&buf, nil, DocumentationFormatMarkdown)
+	require.NoError(err)
+	page := buf.String()
+	assert.Contains(page, "# test\n\nA test program.\n")
+	assert.Contains(page, "```\ntest OPTIONS <command>\n```\n")
+	assert.Contains(page, "| [foo](test-foo.md) | Foo command. |\n")
+	assert.Contains(page, "| `-c, --option-c <value>` | An option. "+
+		"(default: foo) |\n")
+
+	buf.Reset()
+	err = p.WriteDocumentationPage(&buf, p.commands["foo"],
+		DocumentationFormatHTML)
+	require.NoError(err)
+	page = buf.String()
+	assert.Contains(page, "<h1>test foo</h1>\n")
+	assert.Contains(page, "<p>Parent: <a href=\"test.html\">test</a></p>\n")
+	assert.Contains(page, "<pre>test foo OPTIONS &lt;arg-1&gt; &lt;arg-2&gt; "+
+		"[&lt;arg-3&gt;...]</pre>\n")
+	assert.Contains(page, "<h2>Command options</h2>\n")
+	assert.Contains(page, "<dt><code>-d, --[no-]flag-d</code></dt>\n")
+}
+
+func TestWriteDocumentation(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+	p.AddCommand("secret", "a hidden command", func(*Program) {}).Hidden =
+		true
+
+	dir := t.TempDir()
+
+	err := p.WriteDocumentation(dir, DocumentationFormatMarkdown)
+	require.NoError(err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(err)
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	assert.Equal([]string{"test-bar.md", "test-foo.md", "test.md"}, names)
+
+	assert.FileExists(filepath.Join(dir, "test-foo.md"))
+	assert.Error(p.WriteDocumentation(dir, "pdf"))
+}
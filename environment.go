@@ -0,0 +1,88 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"os"
+	"strings"
+	"unicode"
+)
+
+func (p *Program) EnableEnvironment() {
+	p.EnvironmentPrefix = environmentVariableName(p.Name)
+}
+
+func (p *Program) optionEnvironmentVariable(opt *Option) string {
+	if opt.EnvironmentVariable != "" {
+		return opt.EnvironmentVariable
+	}
+
+	if p.EnvironmentPrefix == "" || opt.LongName == "" {
+		return ""
+	}
+
+	if opt == p.options["help"] {
+		return ""
+	}
+
+	return p.EnvironmentPrefix + "_" + environmentVariableName(opt.LongName)
+}
+
+func environmentVariableName(s string) string {
+	return strings.Map(func(c rune) rune {
+		if c > unicode.MaxASCII ||
+			!(unicode.IsLetter(c) || unicode.IsDigit(c)) {
+			return '_'
+		}
+
+		return unicode.ToUpper(c)
+	}, s)
+}
+
+func (p *Program) applyEnvironment() error {
+	// Command line options have precedence over environment variables.
+
+	for _, opt := range p.activeOptions() {
+		if opt.Set || opt.Negated {
+			continue
+		}
+
+		name := p.optionEnvironmentVariable(opt)
+		if name == "" {
+			continue
+		}
+
+		value, found := os.LookupEnv(name)
+		if !found {
+			continue
+		}
+
+		if err := opt.setExternalValue(value); err != nil {
+			return &InvalidEnvironmentValueError{
+				Variable: name,
+				Value:    value,
+				Err:      err,
+			}
+		}
+
+		opt.source = OptionSource{
+			Type:     OptionSourceEnvironment,
+			Variable: name,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironment(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+	p.Name = "my-tool"
+	p.EnableEnvironment()
+	p.AddNegatableFlag("", "color", "true", "")
+	p.AddOption("", "token", "token", "", "").EnvironmentVariable = "TOKEN"
+
+	assert.Equal("MY_TOOL", p.EnvironmentPrefix)
+
+	t.Setenv("MY_TOOL_OPTION_C", "env")
+	t.Setenv("MY_TOOL_FLAG_A", "true")
+	t.Setenv("MY_TOOL_COLOR", "false")
+	t.Setenv("MY_TOOL_DEBUG", "2")
+	t.Setenv("TOKEN", "secret")
+
+	err := p.ParseArgs([]string{"bar"})
+	require.NoError(err)
+	assert.Equal("env", p.OptionValue("option-c"))
+	assert.True(p.IsOptionSet("flag-a"))
+	assert.False(p.BoolOptionValue("color"))
+	assert.Equal(2, p.DebugLevel)
+	assert.Equal("secret", p.OptionValue("token"))
+
+	err = p.ParseArgs([]string{"-c", "cli", "--color", "bar"})
+	require.NoError(err)
+	assert.Equal("cli", p.OptionValue("option-c"))
+	assert.True(p.BoolOptionValue("color"))
+
+	t.Setenv("MY_TOOL_FLAG_A", "foo")
+
+	err = p.ParseArgs([]string{"bar"})
+	var envErr *InvalidEnvironmentValueError
+	if assert.ErrorAs(err, &envErr) {
+		assert.Equal("MY_TOOL_FLAG_A", envErr.Variable)
+	}
+}
+
+func TestEnvironmentCountedFlags(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+	p.EnableEnvironment()
+	p.SetDebugFlag("v", "verbose", "")
+
+	t.Setenv("TEST_VERBOSE", "3")
+
+	err := p.ParseArgs([]string{"bar"})
+	require.NoError(err)
+	assert.Equal(3, p.DebugLevel)
+
+	t.Setenv("TEST_VERBOSE", "true")
+
+	err = p.ParseArgs([]string{"bar"})
+	require.NoError(err)
+	assert.Equal(1, p.DebugLevel)
+
+	t.Setenv("TEST_VERBOSE", "-1")
+
+	err = p.ParseArgs([]string{"bar"})
+	var envErr *InvalidEnvironmentValueError
+	assert.ErrorAs(err, &envErr)
+}
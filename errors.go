@@ -0,0 +1,163 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"fmt"
+)
+
+type UnknownOptionError struct {
+	Option string
+}
+
+func (err *UnknownOptionError) Error() string {
+	return fmt.Sprintf("unknown option %q", err.Option)
+}
+
+type MissingOptionsError struct {
+	Options []string
+}
+
+func (err *MissingOptionsError) Error() string {
+	if len(err.Options) == 1 {
+		return "missing required option " + quotedNames(err.Options)
+	}
+
+	return "missing required options " + quotedNames(err.Options)
+}
+
+type MissingOptionValueError struct {
+	Option string
+}
+
+func (err *MissingOptionValueError) Error() string {
+	return fmt.Sprintf("missing value for option %q", err.Option)
+}
+
+type UnexpectedOptionValueError struct {
+	Option string
+}
+
+func (err *UnexpectedOptionValueError) Error() string {
+	return fmt.Sprintf("option %q does not take a value", err.Option)
+}
+
+type InvalidOptionClusterError struct {
+	Cluster string
+	Option  string
+}
+
+func (err *InvalidOptionClusterError) Error() string {
+	return fmt.Sprintf("option %q requires a value and cannot appear in "+
+		"the middle of %q", err.Option, err.Cluster)
+}
+
+type InvalidOptionValueError struct {
+	Option string
+	Value  string
+	Err    error
+}
+
+func (err *InvalidOptionValueError) Error() string {
+	return fmt.Sprintf("invalid value %q for option %q: %v",
+		err.Value, err.Option, err.Err)
+}
+
+func (err *InvalidOptionValueError) Unwrap() error {
+	return err.Err
+}
+
+type InvalidEnvironmentValueError struct {
+	Variable string
+	Value    string
+	Err      error
+}
+
+func (err *InvalidEnvironmentValueError) Error() string {
+	return fmt.Sprintf("invalid value %q for environment variable %q: %v",
+		err.Value, err.Variable, err.Err)
+}
+
+func (err *InvalidEnvironmentValueError) Unwrap() error {
+	return err.Err
+}
+
+type ConfigFileError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (err *ConfigFileError) Error() string {
+	if err.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", err.Path, err.Line, err.Err)
+	}
+
+	return fmt.Sprintf("%s: %v", err.Path, err.Err)
+}
+
+func (err *ConfigFileError) Unwrap() error {
+	return err.Err
+}
+
+type MissingCommandError struct {
+}
+
+func (err *MissingCommandError) Error() string {
+	return "missing command"
+}
+
+type UnknownCommandError struct {
+	Command string
+}
+
+func (err *UnknownCommandError) Error() string {
+	return fmt.Sprintf("unknown command %q", err.Command)
+}
+
+type MissingArgumentsError struct {
+	Arguments []string
+}
+
+func (err *MissingArgumentsError) Error() string {
+	if len(err.Arguments) == 1 {
+		return "missing argument " + quotedNames(err.Arguments)
+	}
+
+	return "missing arguments " + quotedNames(err.Arguments)
+}
+
+type InvalidArgumentValueError struct {
+	Argument string
+	Value    string
+	Err      error
+}
+
+func (err *InvalidArgumentValueError) Error() string {
+	return fmt.Sprintf("invalid value %q for argument %q: %v",
+		err.Value, err.Argument, err.Err)
+}
+
+func (err *InvalidArgumentValueError) Unwrap() error {
+	return err.Err
+}
+
+type TooManyArgumentsError struct {
+}
+
+func (err *TooManyArgumentsError) Error() string {
+	return "too many arguments"
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The man page flag is handled by ParseCommandLine before parsing the command
+// line, e.g. "prog --man-page remote add" prints the man page of the "remote
+// add" command; it is therefore available to programs without commands and
+// does not require the program to be correctly configured.
+const ManPageFlagName = "--man-page"
+
+func (p *Program) EnableManPageFlag() {
+	p.manPageFlag = true
+}
+
+func (p *Program) writeManPageForPath(w io.Writer, path []string) error {
+	command, err := p.findCommandPath(path)
+	if err != nil {
+		return err
+	}
+
+	if err := p.WriteManPage(w, command); err != nil {
+		return fmt.Errorf("cannot write man page: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Program) ManPageName(command *Command) string {
+	// Commands have their own page, e.g. "git-remote-add" for the "remote
+	// add" command of the "git" program.
+
+	if command == nil {
+		return p.Name
+	}
+
+	return p.Name + "-" + strings.Join(command.Path(), "-")
+}
+
+func (p *Program) WriteManPage(w io.Writer, command *Command) error {
+	var buf bytes.Buffer
+
+	commands := p.commands
+	arguments := p.arguments
+	description := p.Description
+	name := p.Name
+
+	if command != nil {
+		commands = command.commands
+		arguments = command.arguments
+		description = command.Description
+		name = p.Name + " " + command.FullName()
+	}
+
+	pageName := p.ManPageName(command)
+
+	fmt.Fprintf(&buf, ".TH %s 1\n", roffQuote(strings.ToUpper(pageName)))
+
+	fmt.Fprintf(&buf, ".SH NAME\n")
+	if description == "" {
+		fmt.Fprintf(&buf, "%s\n", roffEscape(pageName))
+	} else {
+		fmt.Fprintf(&buf, "%s \\- %s\n", roffEscape(pageName),
+			roffEscape(description))
+	}
+
+	fmt.Fprintf(&buf, ".SH SYNOPSIS\n")
+	fmt.Fprintf(&buf, ".B %s\n", roffEscape(name))
+	fmt.Fprintf(&buf, "[\\fIOPTIONS\\fR]")
+	if len(commands) > 0 {
+		fmt.Fprintf(&buf, " \\fI<command>\\fR")
+	} else {
+		for _, arg := range arguments {
+			argName := roffEscape(arg.Name)
+
+			if arg.Trailing {
+				fmt.Fprintf(&buf, " [\\fI<%s>\\fR...]", argName)
+			} else if arg.Optional {
+				fmt.Fprintf(&buf, " [\\fI<%s>\\fR]", argName)
+			} else {
+				fmt.Fprintf(&buf, " \\fI<%s>\\fR", argName)
+			}
+		}
+	}
+	fmt.Fprintf(&buf, "\n")
+
+	if description != "" {
+		fmt.Fprintf(&buf, ".SH DESCRIPTION\n")
+		fmt.Fprintf(&buf, "%s\n", roffEscape(sentence(description)))
+	}
+
+	if subcommands := visibleCommands(commands); len(subcommands) > 0 {
+		fmt.Fprintf(&buf, ".SH COMMANDS\n")
+
+		for _, c := range subcommands {
+			fmt.Fprintf(&buf, ".TP\n")
+			fmt.Fprintf(&buf, ".B %s\n", roffEscape(c.Name))
+			fmt.Fprintf(&buf, "%s\n", roffEscape(sentence(c.Description)))
+		}
+	} else if len(arguments) > 0 {
+		fmt.Fprintf(&buf, ".SH ARGUMENTS\n")
+
+		for _, arg := range arguments {
+			fmt.Fprintf(&buf, ".TP\n")
+			fmt.Fprintf(&buf, ".I <%s>\n", roffEscape(arg.Name))
+			fmt.Fprintf(&buf, "%s\n", roffEscape(sentence(arg.Description)))
+		}
+	}
+
+	options := p.scopeOptions(command)
+
+	if len(options) > 0 {
+		fmt.Fprintf(&buf, ".SH OPTIONS\n")
+
+		for _, opt := range options {
+			p.manOption(&buf, opt)
+		}
+	}
+
+	var envOptions []*Option
+	for _, opt := range options {
+		if p.optionEnvironmentVariable(opt) != "" {
+			envOptions = append(envOptions, opt)
+		}
+	}
+
+	if len(envOptions) > 0 {
+		fmt.Fprintf(&buf, ".SH ENVIRONMENT\n")
+
+		for _, opt := range envOptions {
+			fmt.Fprintf(&buf, ".TP\n")
+			fmt.Fprintf(&buf, ".B %s\n",
+				roffEscape(p.optionEnvironmentVariable(opt)))
+			fmt.Fprintf(&buf, "Value of the %s option.\n",
+				roffEscape(optionUsageName(opt.name())))
+		}
+	}
+
+	fmt.Fprintf(&buf, ".SH EXIT STATUS\n")
+	fmt.Fprintf(&buf, "The program exits with status 0 on success and 1 "+
+		"if an error occurs.\n")
+
+	var seeAlso []string
+	if command != nil {
+		seeAlso = append(seeAlso, p.ManPageName(command.parent))
+	}
+
+	for _, c := range visibleCommands(commands) {
+		seeAlso = append(seeAlso, p.ManPageName(c))
+	}
+
+	if len(seeAlso) > 0 {
+		fmt.Fprintf(&buf, ".SH SEE ALSO\n")
+
+		for i, pageName := range seeAlso {
+			separator := ","
+			if i == len(seeAlso)-1 {
+				separator = ""
+			}
+
+			fmt.Fprintf(&buf, ".BR %s (1)%s\n", roffEscape(pageName),
+				separator)
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (p *Program) manOption(buf *bytes.Buffer, opt *Option) {
+	var names []string
+
+	if opt.ShortName != "" {
+		names = append(names, "\\fB\\-"+roffEscape(opt.ShortName)+"\\fR")
+	}
+
+	if opt.LongName != "" {
+		if opt.negatable() {
+			names = append(names,
+				"\\fB\\-\\-[no\\-]"+roffEscape(opt.LongName)+"\\fR")
+		} else {
+			names = append(names, "\\fB\\-\\-"+roffEscape(opt.LongName)+"\\fR")
+		}
+	}
+
+	fmt.Fprintf(buf, ".TP\n")
+	fmt.Fprintf(buf, "%s", strings.Join(names, ", "))
+
+	if valueUsage := opt.valueUsage(); valueUsage != "" {
+		fmt.Fprintf(buf, " \\fI%s\\fR", roffEscape(valueUsage))
+	}
+
+	fmt.Fprintf(buf, "\n")
+
+	fmt.Fprintf(buf, "%s", roffEscape(sentence(opt.Description)))
+
+	if len(opt.Choices) > 0 {
+		fmt.Fprintf(buf, " Valid values are %s.",
+			roffEscape(strings.Join(opt.Choices, ", ")))
+	}
+
+	if opt.Required {
+		fmt.Fprintf(buf, " This option is required.")
+	} else if opt.DefaultValue != "" && !opt.Secret {
+		fmt.Fprintf(buf, " The default value is %s.",
+			roffEscape(opt.DefaultValue))
+	}
+
+	fmt.Fprintf(buf, "\n")
+}
+
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+
+	return s
+}
+
+func roffQuote(s string) string {
+	return `"` + strings.ReplaceAll(roffEscape(s), `"`, `\(dq`) + `"`
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteManPage(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+	p.EnvironmentPrefix = "TEST"
+	p.AddCommand("secret", "a hidden command", func(*Program) {}).Hidden =
+		true
+	p.addDefaultCommands()
+
+	var buf bytes.Buffer
+
+	require.NoError(p.WriteManPage(&buf, nil))
+	page := buf.String()
+	assert.Contains(page, ".TH \"TEST\" 1\n")
+	assert.Contains(page, ".SH NAME\ntest \\- a test program\n")
+	assert.Contains(page, ".B test\n[\\fIOPTIONS\\fR] \\fI<command>\\fR\n")
+	assert.Contains(page, ".TP\n.B foo\nFoo command.\n")
+	assert.NotContains(page, ".B secret\n")
+	assert.Contains(page, ".TP\n\\fB\\-c\\fR, \\fB\\-\\-option\\-c\\fR "+
+		"\\fI<value>\\fR\nAn option. The default value is foo.\n")
+	assert.Contains(page, ".TP\n.B TEST_OPTION_C\n")
+	assert.Contains(page, ".SH EXIT STATUS\n")
+
+	buf.Reset()
+	require.NoError(p.WriteManPage(&buf, p.commands["foo"]))
+	page = buf.String()
+	assert.Contains(page, ".TH \"TEST\\-FOO\" 1\n")
+	assert.Contains(page, "[\\fIOPTIONS\\fR] \\fI<arg\\-1>\\fR "+
+		"\\fI<arg\\-2>\\fR [\\fI<arg\\-3>\\fR...]\n")
+	assert.Contains(page, ".SH ARGUMENTS\n")
+	assert.Contains(page, ".SH SEE ALSO\n.BR test (1)\n")
+}
+
+func TestManPageFlag(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var buf bytes.Buffer
+
+	p := NewProgram("test", "a test program")
+	p.AddOption("", "token", "token", "", "").Required = true
+	p.AddArgument("path", "the path")
+	p.SetMain(func(*Program) {})
+
+	handled, err := p.handleBuiltinArgs(&buf, []string{ManPageFlagName})
+	require.NoError(err)
+	assert.False(handled)
+
+	p.EnableManPageFlag()
+
+	handled, err = p.handleBuiltinArgs(&buf, []string{ManPageFlagName})
+	require.NoError(err)
+	assert.True(handled)
+	assert.Contains(buf.String(), ".TH \"TEST\" 1\n")
+
+	p = newTestProgram()
+	p.AddOption("", "token", "token", "", "").Required = true
+	p.EnableManPageFlag()
+
+	buf.Reset()
+	handled, err = p.handleBuiltinArgs(&buf, []string{ManPageFlagName, "foo"})
+	require.NoError(err)
+	assert.True(handled)
+	assert.Contains(buf.String(), ".TH \"TEST\\-FOO\" 1\n")
+
+	_, err = p.handleBuiltinArgs(&buf, []string{ManPageFlagName, "baz"})
+	var commandErr *UnknownCommandError
+	assert.ErrorAs(err, &commandErr)
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type OptionConstraintType int
+
+const (
+	// Exactly one of the options must be set.
+	OptionConstraintExactlyOneOf OptionConstraintType = iota
+
+	// At most one of the options can be set.
+	OptionConstraintAtMostOneOf
+
+	// Either all options are set, or none of them is.
+	OptionConstraintAllOrNone
+
+	// If the first option is set, all other options must be set.
+	OptionConstraintRequires
+)
+
+func (t OptionConstraintType) String() string {
+	switch t {
+	case OptionConstraintExactlyOneOf:
+		return "exactly_one_of"
+	case OptionConstraintAtMostOneOf:
+		return "at_most_one_of"
+	case OptionConstraintAllOrNone:
+		return "all_or_none"
+	case OptionConstraintRequires:
+		return "requires"
+	}
+
+	return fmt.Sprintf("OptionConstraintType(%d)", int(t))
+}
+
+type OptionConstraint struct {
+	Type    OptionConstraintType
+	Options []string
+}
+
+type OptionConstraintError struct {
+	Constraint *OptionConstraint
+	Options    []string
+}
+
+func (err *OptionConstraintError) Error() string {
+	c := err.Constraint
+
+	switch c.Type {
+	case OptionConstraintExactlyOneOf:
+		if len(err.Options) == 0 {
+			return fmt.Sprintf("one of the options %s must be set",
+				quotedNames(c.Options))
+		}
+
+		return fmt.Sprintf("options %s cannot be used together",
+			quotedNames(err.Options))
+
+	case OptionConstraintAtMostOneOf:
+		return fmt.Sprintf("options %s cannot be used together",
+			quotedNames(err.Options))
+
+	case OptionConstraintAllOrNone:
+		return fmt.Sprintf("options %s must be used together",
+			quotedNames(c.Options))
+
+	case OptionConstraintRequires:
+		return fmt.Sprintf("option %q requires %s",
+			c.Options[0], quotedNames(err.Options))
+	}
+
+	return "invalid options"
+}
+
+func (p *Program) AddOptionConstraint(constraintType OptionConstraintType, names ...string) *OptionConstraint {
+	constraint := p.newOptionConstraint(nil, constraintType, names)
+	p.constraints = append(p.constraints, constraint)
+	return constraint
+}
+
+func (c *Command) AddOptionConstraint(constraintType OptionConstraintType, names ...string) *OptionConstraint {
+	constraint := c.program.newOptionConstraint(c, constraintType, names)
+	c.constraints = append(c.constraints, constraint)
+	return constraint
+}
+
+func (p *Program) newOptionConstraint(command *Command, constraintType OptionConstraintType, names []string) *OptionConstraint {
+	if len(names) < 2 {
+		panic("option constraints require at least two options")
+	}
+
+	// Constraints are checked for every command the options are visible
+	// from, so they can only refer to options already defined in the scope
+	// of the command (or to global options for program constraints).
+	for _, name := range names {
+		if p.findOption(command, name) == nil {
+			panicf("unknown option %q in option constraint", name)
+		}
+	}
+
+	return &OptionConstraint{
+		Type:    constraintType,
+		Options: names,
+	}
+}
+
+func (p *Program) activeConstraints(command *Command) []*OptionConstraint {
+	var constraints []*OptionConstraint
+
+	constraints = append(constraints, p.constraints...)
+
+	for _, c := range commandChain(command) {
+		constraints = append(constraints, c.constraints...)
+	}
+
+	return constraints
+}
+
+func (p *Program) checkOptionConstraints() error {
+	for _, constraint := range p.activeConstraints(p.command) {
+		if err := p.checkOptionConstraint(constraint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Program) checkOptionConstraint(constraint *OptionConstraint) error {
+	var set, unset []string
+
+	for _, name := range constraint.Options {
+		// Explicitly negated options are set to false and do not count as
+		// being used.
+		if opt := p.findOption(p.command, name); opt.Set && !opt.Negated {
+			set = append(set, name)
+		} else {
+			unset = append(unset, name)
+		}
+	}
+
+	var options []string
+
+	switch constraint.Type {
+	case OptionConstraintExactlyOneOf:
+		if len(set) == 1 {
+			return nil
+		}
+
+		options = set
+
+	case OptionConstraintAtMostOneOf:
+		if len(set) <= 1 {
+			return nil
+		}
+
+		options = set
+
+	case OptionConstraintAllOrNone:
+		if len(set) == 0 || len(unset) == 0 {
+			return nil
+		}
+
+		options = unset
+
+	case OptionConstraintRequires:
+		if len(unset) == 0 || unset[0] == constraint.Options[0] {
+			return nil
+		}
+
+		options = unset
+	}
+
+	return &OptionConstraintError{
+		Constraint: constraint,
+		Options:    options,
+	}
+}
+
+func (p *Program) usageConstraints(buf *bytes.Buffer, command *Command) {
+	constraints := p.activeConstraints(command)
+	if len(constraints) == 0 {
+		return
+	}
+
+	fmt.Fprintf(buf, "\nOPTION CONSTRAINTS\n\n")
+
+	for _, constraint := range constraints {
+		fmt.Fprintf(buf, "%s\n", constraint.usage())
+	}
+}
+
+func (c *OptionConstraint) usage() string {
+	names := make([]string, len(c.Options))
+	for i, name := range c.Options {
+		names[i] = optionUsageName(name)
+	}
+
+	switch c.Type {
+	case OptionConstraintExactlyOneOf:
+		return "exactly one of " + strings.Join(names, ", ")
+	case OptionConstraintAtMostOneOf:
+		return "at most one of " + strings.Join(names, ", ")
+	case OptionConstraintAllOrNone:
+		return "all or none of " + strings.Join(names, ", ")
+	case OptionConstraintRequires:
+		return names[0] + " requires " + strings.Join(names[1:], ", ")
+	}
+
+	return ""
+}
+
+func optionUsageName(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+
+	return "--" + name
+}
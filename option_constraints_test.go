@@ -0,0 +1,109 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionConstraints(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewProgram("test", "")
+
+	c := p.AddCommand("fetch", "", func(*Program) {})
+	c.AddOption("f", "file", "path", "", "")
+	c.AddOption("u", "url", "url", "", "")
+	c.AddOption("", "tls-cert", "path", "", "")
+	c.AddOption("", "tls-key", "path", "", "")
+	c.AddOption("", "tls-ca", "path", "", "")
+	c.AddFlag("", "json", "")
+	c.AddFlag("", "yaml", "")
+
+	c.AddOptionConstraint(OptionConstraintExactlyOneOf, "file", "url")
+	c.AddOptionConstraint(OptionConstraintAtMostOneOf, "json", "yaml")
+	c.AddOptionConstraint(OptionConstraintAllOrNone, "tls-cert", "tls-key")
+	c.AddOptionConstraint(OptionConstraintRequires, "tls-ca", "tls-cert")
+
+	tests := []struct {
+		args    []string
+		options []string
+	}{
+		{[]string{"fetch", "-f", "a"},
+			nil},
+		{[]string{"fetch", "-u", "a", "--tls-cert", "a", "--tls-key", "b",
+			"--tls-ca", "c", "--yaml"},
+			nil},
+		{[]string{"fetch"},
+			[]string{}},
+		{[]string{"fetch", "-f", "a", "-u", "b"},
+			[]string{"file", "url"}},
+		{[]string{"fetch", "-f", "a", "--json", "--yaml"},
+			[]string{"json", "yaml"}},
+		{[]string{"fetch", "-f", "a", "--tls-key", "b"},
+			[]string{"tls-cert"}},
+		{[]string{"fetch", "-f", "a", "--tls-ca", "c"},
+			[]string{"tls-cert"}},
+		{[]string{"fetch", "-f", "a", "--json", "--no-yaml"},
+			nil},
+	}
+
+	for _, test := range tests {
+		err := p.ParseArgs(test.args)
+
+		if test.options == nil {
+			assert.NoError(err, test.args)
+			continue
+		}
+
+		var constraintErr *OptionConstraintError
+		if assert.ErrorAs(err, &constraintErr, test.args) {
+			assert.ElementsMatch(test.options, constraintErr.Options,
+				test.args)
+		}
+	}
+}
+
+func TestOptionConstraintsUnknownOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	p := NewProgram("test", "")
+	p.AddFlag("", "global", "")
+
+	c := p.AddCommand("fetch", "", func(*Program) {})
+	c.AddFlag("", "json", "")
+
+	p.AddCommand("push", "", func(*Program) {})
+
+	assert.Panics(func() {
+		p.AddOptionConstraint(OptionConstraintAtMostOneOf, "global", "json")
+	})
+
+	assert.Panics(func() {
+		c.AddOptionConstraint(OptionConstraintAtMostOneOf, "json", "yaml")
+	})
+
+	c.AddOptionConstraint(OptionConstraintAtMostOneOf, "global", "json")
+
+	assert.NoError(p.ParseArgs([]string{"push", "--global"}))
+	assert.NoError(p.ParseArgs([]string{"fetch", "--json"}))
+
+	var constraintErr *OptionConstraintError
+	assert.ErrorAs(p.ParseArgs([]string{"fetch", "--json", "--global"}),
+		&constraintErr)
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const OptionTableDebugLevel = 2
+
+type OptionSourceType int
+
+const (
+	OptionSourceNone OptionSourceType = iota
+	OptionSourceDefault
+	OptionSourceCommandLine
+	OptionSourceEnvironment
+	OptionSourceConfigFile
+)
+
+func (t OptionSourceType) String() string {
+	switch t {
+	case OptionSourceNone:
+		return "none"
+	case OptionSourceDefault:
+		return "default"
+	case OptionSourceCommandLine:
+		return "command line"
+	case OptionSourceEnvironment:
+		return "environment"
+	case OptionSourceConfigFile:
+		return "config file"
+	}
+
+	return fmt.Sprintf("OptionSourceType(%d)", int(t))
+}
+
+type OptionSource struct {
+	Type OptionSourceType
+
+	// Environment variables
+	Variable string
+
+	// Configuration files
+	Path string
+	Line int
+}
+
+func (s OptionSource) String() string {
+	switch s.Type {
+	case OptionSourceEnvironment:
+		return "environment variable " + s.Variable
+	case OptionSourceConfigFile:
+		if s.Line > 0 {
+			return fmt.Sprintf("config file %s:%d", s.Path, s.Line)
+		}
+
+		return "config file " + s.Path
+	}
+
+	return s.Type.String()
+}
+
+func (p *Program) OptionSource(name string) OptionSource {
+	return p.mustOption(name).Source()
+}
+
+func (opt *Option) Source() OptionSource {
+	if opt.Set || opt.Negated {
+		return opt.source
+	}
+
+	if opt.DefaultValue != "" {
+		return OptionSource{Type: OptionSourceDefault}
+	}
+
+	return OptionSource{Type: OptionSourceNone}
+}
+
+func (p *Program) setOptionSources(source OptionSource) {
+	// Record the source of all options which have been set but do not have
+	// a source yet, i.e. options set during the last parsing step.
+
+	for _, opt := range p.activeOptions() {
+		if (opt.Set || opt.Negated) && opt.source.Type == OptionSourceNone {
+			opt.source = source
+		}
+	}
+}
+
+func (p *Program) WriteOptionTable(w io.Writer) {
+	options := p.activeOptions()
+
+	rows := make([][3]string, len(options))
+	widths := [2]int{}
+
+	for i, opt := range options {
+		rows[i] = [3]string{opt.name(), opt.displayValue(),
+			opt.Source().String()}
+
+		for j := 0; j < 2; j++ {
+			if len(rows[i][j]) > widths[j] {
+				widths[j] = len(rows[i][j])
+			}
+		}
+	}
+
+	for _, row := range rows {
+		fmt.Fprintf(w, "%-*s  %-*s  %s\n",
+			widths[0], row[0], widths[1], row[1], row[2])
+	}
+}
+
+func (p *Program) printOptionTable() {
+	var buf strings.Builder
+	p.WriteOptionTable(&buf)
+
+	fmt.Fprintf(os.Stderr, "options:\n")
+
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line != "" {
+			fmt.Fprintf(os.Stderr, "  %s", line)
+		}
+	}
+}
+
+func (opt *Option) displayValue() string {
+	var value string
+
+	switch {
+	case opt.Negated:
+		value = "false"
+
+	case !opt.Set:
+		if opt.DefaultValue == "" {
+			return "-"
+		}
+
+		value = opt.DefaultValue
+
+	case opt.isFlag():
+		if opt.Count > 1 {
+			value = fmt.Sprintf("true (x%d)", opt.Count)
+		} else {
+			value = "true"
+		}
+
+	case opt.Repeatable:
+		value = strings.Join(opt.Values, ", ")
+
+	default:
+		value = opt.Value
+	}
+
+	if opt.Secret {
+		return "********"
+	}
+
+	return value
+}
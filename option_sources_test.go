@@ -0,0 +1,68 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionSource(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("XDG_CONFIG_DIRS", filepath.Join(dir, "none"))
+
+	p := newTestProgram()
+	p.Name = "my-tool"
+	p.EnableEnvironment()
+	p.EnableConfigFile()
+	p.AddOption("", "token", "token", "", "").Secret = true
+	p.AddOption("", "level", "level", "", "")
+
+	path := filepath.Join(dir, "my-tool", "config.json")
+	writeTestFile(t, path, "{\n  \"level\": \"3\"\n}")
+
+	t.Setenv("MY_TOOL_TOKEN", "secret")
+
+	err := p.ParseArgs([]string{"--flag-a", "bar"})
+	require.NoError(err)
+
+	assert.Equal(OptionSource{Type: OptionSourceCommandLine},
+		p.OptionSource("flag-a"))
+	assert.Equal(OptionSource{Type: OptionSourceEnvironment,
+		Variable: "MY_TOOL_TOKEN"}, p.OptionSource("token"))
+	assert.Equal(OptionSource{Type: OptionSourceConfigFile,
+		Path: path, Line: 2}, p.OptionSource("level"))
+	assert.Equal(OptionSource{Type: OptionSourceDefault},
+		p.OptionSource("option-c"))
+	assert.Equal(OptionSource{Type: OptionSourceNone},
+		p.OptionSource("b"))
+
+	var buf strings.Builder
+	p.WriteOptionTable(&buf)
+
+	table := buf.String()
+	assert.Contains(table, "********")
+	assert.NotContains(table, "secret")
+	assert.Contains(table, "config file "+path+":2")
+}
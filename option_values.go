@@ -0,0 +1,669 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Value interface {
+	Set(string) error
+	String() string
+	Type() string
+}
+
+type OptionType string
+
+const (
+	OptionTypeString   OptionType = "string"
+	OptionTypeInt      OptionType = "int"
+	OptionTypeInt64    OptionType = "int64"
+	OptionTypeUint     OptionType = "uint"
+	OptionTypeFloat64  OptionType = "float64"
+	OptionTypeBool     OptionType = "bool"
+	OptionTypeDuration OptionType = "duration"
+	OptionTypeTime     OptionType = "time"
+	OptionTypeByteSize OptionType = "size"
+	OptionTypeURL      OptionType = "url"
+	OptionTypeIP       OptionType = "ip"
+	OptionTypeCIDR     OptionType = "cidr"
+	OptionTypeRegexp   OptionType = "regexp"
+	OptionTypeMap      OptionType = "map"
+)
+
+type mapEntry struct {
+	key   string
+	value string
+}
+
+var byteSizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+}
+
+func (opt *Option) setFlag() error {
+	if opt.Var != nil {
+		if err := opt.Var.Set("true"); err != nil {
+			return err
+		}
+	}
+
+	opt.Set = true
+	opt.Negated = false
+	opt.Count++
+	opt.Value = "true"
+
+	return nil
+}
+
+func (opt *Option) negateFlag() error {
+	// A negated option is explicitly set to false: it is reported as set,
+	// and its value is not replaced by the default value.
+
+	if opt.Var != nil {
+		if err := opt.Var.Set("false"); err != nil {
+			return err
+		}
+	}
+
+	opt.Set = true
+	opt.Negated = true
+	opt.Count = 0
+	opt.Value = "false"
+	opt.Values = nil
+	opt.value = zeroOptionValue(opt.Type)
+
+	return nil
+}
+
+func (opt *Option) setValue(s string) error {
+	values := opt.splitValue(s)
+
+	parsedValues := make([]interface{}, len(values))
+	for i, value := range values {
+		if err := opt.checkChoice(value); err != nil {
+			return err
+		}
+
+		parsedValue, err := opt.parseValue(value)
+		if err != nil {
+			return err
+		}
+
+		parsedValues[i] = parsedValue
+	}
+
+	if opt.Type == OptionTypeMap {
+		var m map[string]string
+		if opt.Set {
+			m = opt.value.(map[string]string)
+		}
+
+		m, err := addMapEntries(m, parsedValues)
+		if err != nil {
+			return err
+		}
+
+		opt.value = m
+	} else {
+		opt.value = parsedValues[len(parsedValues)-1]
+	}
+
+	if opt.Var != nil {
+		for _, value := range values {
+			if err := opt.Var.Set(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	opt.Set = true
+	opt.Count++
+	opt.Value = s
+
+	if opt.Repeatable {
+		opt.Values = append(opt.Values, values...)
+	} else {
+		opt.Values = values
+	}
+
+	return nil
+}
+
+func addMapEntries(m map[string]string, entries []interface{}) (map[string]string, error) {
+	m2 := make(map[string]string, len(m)+len(entries))
+	for key, value := range m {
+		m2[key] = value
+	}
+
+	for _, e := range entries {
+		entry := e.(mapEntry)
+
+		if _, found := m2[entry.key]; found {
+			return nil, fmt.Errorf("duplicate key %q", entry.key)
+		}
+
+		m2[entry.key] = entry.value
+	}
+
+	return m2, nil
+}
+
+func (opt *Option) setExternalValue(s string) error {
+	// Values coming from the environment or from configuration files are
+	// strings for all options, including flags.
+
+	if !opt.isFlag() {
+		return opt.setValue(s)
+	}
+
+	// Counted flags also accept the number of occurrences.
+	if opt.Counted {
+		if n, err := strconv.ParseUint(s, 10, 31); err == nil {
+			if n == 0 {
+				return opt.setExternalValue("false")
+			}
+
+			for i := uint64(0); i < n; i++ {
+				if err := opt.setFlag(); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		if opt.Counted {
+			return fmt.Errorf("invalid count")
+		}
+
+		return fmt.Errorf("invalid boolean")
+	}
+
+	if b {
+		return opt.setFlag()
+	} else if opt.negatable() {
+		return opt.negateFlag()
+	}
+
+	return nil
+}
+
+func (opt *Option) checkChoice(s string) error {
+	if len(opt.Choices) == 0 {
+		return nil
+	}
+
+	for _, choice := range opt.Choices {
+		if s == choice {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("value must be one of %s", strings.Join(opt.Choices, ", "))
+}
+
+func (opt *Option) splitValue(s string) []string {
+	if !opt.Repeatable || opt.Separator == "" {
+		return []string{s}
+	}
+
+	return strings.Split(s, opt.Separator)
+}
+
+func (opt *Option) isFlag() bool {
+	if opt.ValueName != "" || opt.Type != "" {
+		return false
+	}
+
+	if opt.Var == nil {
+		return true
+	}
+
+	boolValue, ok := opt.Var.(BoolValue)
+	return ok && boolValue.IsBoolFlag()
+}
+
+func (opt *Option) negatable() bool {
+	// Flags with a long name can always be negated with "--no-<name>". This
+	// is computed on use since whether an option is a flag can change after
+	// registration, e.g. when Var is set.
+
+	if opt.LongName == "" || opt.noNegation {
+		return false
+	}
+
+	return opt.Negatable || opt.isFlag()
+}
+
+func (opt *Option) valueName() string {
+	if opt.ValueName != "" || opt.isFlag() {
+		return opt.ValueName
+	}
+
+	if opt.Var != nil {
+		return opt.Var.Type()
+	}
+
+	return string(opt.Type)
+}
+
+func (opt *Option) valueUsage() string {
+	var s string
+
+	if opt.Type == OptionTypeMap {
+		s = "<key>=<value>"
+	} else if valueName := opt.valueName(); valueName != "" {
+		s = "<" + valueName + ">"
+	}
+
+	if opt.Repeatable {
+		s += "..."
+	}
+
+	return s
+}
+
+func (opt *Option) checkDefaultValue() error {
+	if opt.DefaultValue == "" {
+		return nil
+	}
+
+	if opt.isFlag() {
+		if _, err := strconv.ParseBool(opt.DefaultValue); err != nil {
+			return fmt.Errorf("invalid boolean")
+		}
+
+		return nil
+	}
+
+	// Values which are not typed can only be validated by setting them,
+	// which must not happen before parsing since Set may have side effects;
+	// their default value is validated when it is applied.
+	if opt.Type != "" {
+		_, err := opt.parseDefaultValue()
+		return err
+	}
+
+	return nil
+}
+
+func (opt *Option) applyDefaultValue() {
+	if opt.Set || opt.Negated || opt.Var == nil || opt.DefaultValue == "" {
+		return
+	}
+
+	for _, value := range opt.splitValue(opt.DefaultValue) {
+		if err := opt.Var.Set(value); err != nil {
+			panicf("invalid default value %q for option %q: %v",
+				opt.DefaultValue, opt.name(), err)
+		}
+	}
+}
+
+func (arg *Argument) setValue(s string) error {
+	if arg.Var != nil {
+		if err := arg.Var.Set(s); err != nil {
+			return err
+		}
+	}
+
+	arg.Set = true
+
+	if arg.Trailing {
+		arg.TrailingValues = append(arg.TrailingValues, s)
+	} else {
+		arg.Value = s
+	}
+
+	return nil
+}
+
+func (opt *Option) typedValue(optionType OptionType) interface{} {
+	if opt.Type != optionType {
+		panicf("option %q is not of type %s", opt.name(), optionType)
+	}
+
+	if opt.Set {
+		return opt.value
+	}
+
+	if opt.DefaultValue == "" {
+		return zeroOptionValue(optionType)
+	}
+
+	value, err := opt.parseDefaultValue()
+	if err != nil {
+		panicf("invalid default value %q for option %q: %v",
+			opt.DefaultValue, opt.name(), err)
+	}
+
+	return value
+}
+
+func (opt *Option) parseDefaultValue() (interface{}, error) {
+	defaultOpt := *opt
+
+	defaultOpt.Set = false
+	defaultOpt.Count = 0
+	defaultOpt.Var = nil
+	defaultOpt.Values = nil
+	defaultOpt.value = nil
+
+	if err := defaultOpt.setValue(opt.DefaultValue); err != nil {
+		return nil, err
+	}
+
+	return defaultOpt.value, nil
+}
+
+func (opt *Option) parseValue(s string) (interface{}, error) {
+	switch opt.Type {
+	case "", OptionTypeString:
+		return s, nil
+
+	case OptionTypeInt:
+		i, err := strconv.ParseInt(s, 10, 0)
+		if err != nil {
+			return nil, numberError(err, "integer")
+		}
+
+		return int(i), nil
+
+	case OptionTypeInt64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, numberError(err, "integer")
+		}
+
+		return i, nil
+
+	case OptionTypeUint:
+		i, err := strconv.ParseUint(s, 10, 0)
+		if err != nil {
+			return nil, numberError(err, "positive integer")
+		}
+
+		return uint(i), nil
+
+	case OptionTypeFloat64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, numberError(err, "number")
+		}
+
+		return f, nil
+
+	case OptionTypeBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean")
+		}
+
+		return b, nil
+
+	case OptionTypeDuration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration")
+		}
+
+		return d, nil
+
+	case OptionTypeTime:
+		layout := opt.TimeLayout
+		if layout == "" {
+			layout = time.RFC3339
+		}
+
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time: expected format %q", layout)
+		}
+
+		return t, nil
+
+	case OptionTypeByteSize:
+		return parseByteSize(s)
+
+	case OptionTypeURL:
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url")
+		}
+
+		return u, nil
+
+	case OptionTypeIP:
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip address")
+		}
+
+		return ip, nil
+
+	case OptionTypeCIDR:
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr network address")
+		}
+
+		return network, nil
+
+	case OptionTypeRegexp:
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+
+		return re, nil
+
+	case OptionTypeMap:
+		i := strings.IndexByte(s, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid entry: expected <key>=<value>")
+		}
+
+		return mapEntry{key: s[:i], value: s[i+1:]}, nil
+	}
+
+	panicf("unknown option type %q", opt.Type)
+	return nil, nil // make the compiler happy
+}
+
+func zeroOptionValue(optionType OptionType) interface{} {
+	switch optionType {
+	case OptionTypeInt:
+		return 0
+	case OptionTypeInt64, OptionTypeByteSize:
+		return int64(0)
+	case OptionTypeUint:
+		return uint(0)
+	case OptionTypeFloat64:
+		return float64(0.0)
+	case OptionTypeBool:
+		return false
+	case OptionTypeDuration:
+		return time.Duration(0)
+	case OptionTypeTime:
+		return time.Time{}
+	case OptionTypeURL:
+		return (*url.URL)(nil)
+	case OptionTypeIP:
+		return net.IP(nil)
+	case OptionTypeCIDR:
+		return (*net.IPNet)(nil)
+	case OptionTypeRegexp:
+		return (*regexp.Regexp)(nil)
+	case OptionTypeMap:
+		return map[string]string(nil)
+	}
+
+	return ""
+}
+
+func numberError(err error, typeName string) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Errorf("%s out of range", typeName)
+	}
+
+	return fmt.Errorf("invalid %s", typeName)
+}
+
+func parseByteSize(s string) (int64, error) {
+	// Sizes are a number, optionally followed by a decimal (e.g. "kB",
+	// "MB") or binary (e.g. "KiB", "MiB") unit.
+
+	i := strings.IndexFunc(s, func(c rune) bool {
+		return !(c >= '0' && c <= '9' || c == '.')
+	})
+	if i == -1 {
+		i = len(s)
+	}
+
+	number, unit := s[:i], strings.TrimSpace(s[i:])
+
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size")
+	}
+
+	multiplier, found := byteSizeUnits[strings.ToLower(unit)]
+	if !found {
+		return 0, fmt.Errorf("invalid size unit %q", unit)
+	}
+
+	size := f * multiplier
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("size out of range")
+	}
+
+	return int64(size), nil
+}
+
+func (opt *Option) name() string {
+	if opt.LongName != "" {
+		return opt.LongName
+	}
+
+	return opt.ShortName
+}
+
+func (p *Program) OptionValues(name string) []string {
+	opt := p.mustOption(name)
+	if !opt.Set {
+		if opt.DefaultValue == "" {
+			return nil
+		}
+
+		return opt.splitValue(opt.DefaultValue)
+	}
+
+	return opt.Values
+}
+
+func (p *Program) MapOptionValue(name string) map[string]string {
+	return p.mustOption(name).typedValue(OptionTypeMap).(map[string]string)
+}
+
+func (p *Program) IntOptionValue(name string) int {
+	return p.mustOption(name).typedValue(OptionTypeInt).(int)
+}
+
+func (p *Program) Int64OptionValue(name string) int64 {
+	return p.mustOption(name).typedValue(OptionTypeInt64).(int64)
+}
+
+func (p *Program) UintOptionValue(name string) uint {
+	return p.mustOption(name).typedValue(OptionTypeUint).(uint)
+}
+
+func (p *Program) Float64OptionValue(name string) float64 {
+	return p.mustOption(name).typedValue(OptionTypeFloat64).(float64)
+}
+
+func (p *Program) BoolOptionValue(name string) bool {
+	opt := p.mustOption(name)
+
+	if opt.Type == "" && opt.isFlag() {
+		if opt.Set {
+			return !opt.Negated
+		}
+
+		if opt.DefaultValue == "" {
+			return false
+		}
+
+		b, err := strconv.ParseBool(opt.DefaultValue)
+		if err != nil {
+			panicf("invalid default value %q for option %q: %v",
+				opt.DefaultValue, opt.name(), err)
+		}
+
+		return b
+	}
+
+	return opt.typedValue(OptionTypeBool).(bool)
+}
+
+func (p *Program) DurationOptionValue(name string) time.Duration {
+	return p.mustOption(name).typedValue(OptionTypeDuration).(time.Duration)
+}
+
+func (p *Program) TimeOptionValue(name string) time.Time {
+	return p.mustOption(name).typedValue(OptionTypeTime).(time.Time)
+}
+
+func (p *Program) ByteSizeOptionValue(name string) int64 {
+	return p.mustOption(name).typedValue(OptionTypeByteSize).(int64)
+}
+
+func (p *Program) URLOptionValue(name string) *url.URL {
+	return p.mustOption(name).typedValue(OptionTypeURL).(*url.URL)
+}
+
+func (p *Program) IPOptionValue(name string) net.IP {
+	return p.mustOption(name).typedValue(OptionTypeIP).(net.IP)
+}
+
+func (p *Program) CIDROptionValue(name string) *net.IPNet {
+	return p.mustOption(name).typedValue(OptionTypeCIDR).(*net.IPNet)
+}
+
+func (p *Program) RegexpOptionValue(name string) *regexp.Regexp {
+	return p.mustOption(name).typedValue(OptionTypeRegexp).(*regexp.Regexp)
+}
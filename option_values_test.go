@@ -0,0 +1,359 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseByteSize(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		s    string
+		size int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"10kB", 10_000},
+		{"10KiB", 10_240},
+		{"10MiB", 10 * 1024 * 1024},
+		{"1.5 GiB", 1536 * 1024 * 1024},
+		{"2tb", 2_000_000_000_000},
+	}
+
+	for _, test := range tests {
+		size, err := parseByteSize(test.s)
+		if assert.NoError(err, test.s) {
+			assert.Equal(test.size, size, test.s)
+		}
+	}
+
+	for _, s := range []string{"", "MiB", "-1", "10XB", "1e3"} {
+		_, err := parseByteSize(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestTypedOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := NewProgram("test", "")
+	p.AddTypedOption(OptionTypeInt, "n", "count", "", "3", "")
+	p.AddTypedOption(OptionTypeDuration, "", "timeout", "", "5s", "")
+	p.AddTypedOption(OptionTypeByteSize, "", "size", "", "", "")
+	p.AddTypedOption(OptionTypeCIDR, "", "network", "", "", "")
+	p.AddTypedOption(OptionTypeBool, "", "enabled", "", "", "")
+	p.AddTypedOption(OptionTypeTime, "", "date", "", "", "").TimeLayout =
+		"2006-01-02"
+	p.AddFlag("f", "force", "")
+	p.SetMain(func(*Program) {})
+
+	err := p.ParseArgs([]string{})
+	require.NoError(err)
+	assert.Equal(3, p.IntOptionValue("count"))
+	assert.Equal(5*time.Second, p.DurationOptionValue("timeout"))
+	assert.Equal(int64(0), p.ByteSizeOptionValue("size"))
+	assert.Nil(p.CIDROptionValue("network"))
+	assert.False(p.BoolOptionValue("enabled"))
+	assert.False(p.BoolOptionValue("force"))
+
+	err = p.ParseArgs([]string{"-n", "42", "--timeout=1m", "--size", "2KiB",
+		"--network", "10.0.0.0/8", "--enabled", "true", "--date",
+		"2022-03-01", "-f"})
+	require.NoError(err)
+	assert.Equal(42, p.IntOptionValue("count"))
+	assert.Equal(time.Minute, p.DurationOptionValue("timeout"))
+	assert.Equal(int64(2048), p.ByteSizeOptionValue("size"))
+	assert.Equal("10.0.0.0/8", p.CIDROptionValue("network").String())
+	assert.True(p.CIDROptionValue("network").Contains(net.ParseIP("10.1.2.3")))
+	assert.True(p.BoolOptionValue("enabled"))
+	assert.Equal(time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+		p.TimeOptionValue("date"))
+	assert.True(p.BoolOptionValue("force"))
+
+	err = p.ParseArgs([]string{"--count", "foo"})
+	var invalidValueErr *InvalidOptionValueError
+	if assert.ErrorAs(err, &invalidValueErr) {
+		assert.Equal("count", invalidValueErr.Option)
+		assert.Equal("foo", invalidValueErr.Value)
+	}
+
+	assert.Panics(func() { p.DurationOptionValue("count") })
+	assert.Panics(func() {
+		p.AddTypedOption(OptionTypeInt, "", "invalid", "", "foo", "")
+	})
+}
+
+type testListValue struct {
+	values []string
+}
+
+func (v *testListValue) Set(s string) error {
+	if s == "" {
+		return fmt.Errorf("empty value")
+	}
+
+	v.values = append(v.values, s)
+	return nil
+}
+
+func (v *testListValue) String() string {
+	return strings.Join(v.values, ",")
+}
+
+func (v *testListValue) Type() string {
+	return "list"
+}
+
+func TestValueOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var optValue, argValue testListValue
+
+	p := NewProgram("test", "")
+	p.AddOption("l", "list", "", "", "").Var = &optValue
+	p.AddTrailingArgument("values", "").Var = &argValue
+	p.SetMain(func(*Program) {})
+
+	err := p.ParseArgs([]string{"-l", "a", "--list=b", "c", "d"})
+	require.NoError(err)
+	assert.Equal([]string{"a", "b"}, optValue.values)
+	assert.Equal([]string{"c", "d"}, argValue.values)
+	assert.Equal("b", p.OptionValue("list"))
+	assert.Equal("-l, --list <list>", p.options["list"].usage())
+
+	err = p.ParseArgs([]string{"--no-list"})
+	assert.IsType(&UnknownOptionError{}, err)
+
+	err = p.ParseArgs([]string{"--list="})
+	var invalidOptionValueErr *InvalidOptionValueError
+	if assert.ErrorAs(err, &invalidOptionValueErr) {
+		assert.Equal("list", invalidOptionValueErr.Option)
+	}
+
+	err = p.ParseArgs([]string{"--", ""})
+	var invalidArgumentValueErr *InvalidArgumentValueError
+	if assert.ErrorAs(err, &invalidArgumentValueErr) {
+		assert.Equal("values", invalidArgumentValueErr.Argument)
+	}
+
+	err = p.ParseArgs([]string{"--list"})
+	assert.IsType(&MissingOptionValueError{}, err)
+}
+
+func TestVariables(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var name string
+	var count int
+	var force bool
+	var timeout time.Duration
+	var includes []string
+	var path string
+	var files []string
+
+	p := NewProgram("test", "")
+	p.AddOptionVar(&name, "", "name", "", "foo", "")
+	p.AddOptionVar(&count, "n", "count", "", "1", "")
+	p.AddOptionVar(&force, "f", "force", "", "", "")
+	p.AddOptionVar(&timeout, "", "timeout", "", "10s", "")
+	p.AddOptionVar(&includes, "I", "", "path", "", "")
+	p.AddArgumentVar(&path, "path", "")
+	p.AddTrailingArgumentVar(&files, "files", "")
+	p.SetMain(func(*Program) {})
+
+	err := p.ParseArgs([]string{"-fn", "3", "-I", "a", "-I", "b", "/tmp",
+		"c", "d"})
+	require.NoError(err)
+	assert.Equal("foo", name)
+	assert.Equal(3, count)
+	assert.Equal(3, p.IntOptionValue("count"))
+	assert.True(force)
+	assert.Equal(10*time.Second, timeout)
+	assert.Equal([]string{"a", "b"}, includes)
+	assert.Equal("/tmp", path)
+	assert.Equal([]string{"c", "d"}, files)
+
+	err = p.ParseArgs([]string{"-I", "c", "/tmp", "e"})
+	require.NoError(err)
+	assert.Equal([]string{"c"}, includes)
+	assert.Equal([]string{"e"}, files)
+
+	err = p.ParseArgs([]string{"/tmp"})
+	require.NoError(err)
+	assert.Empty(includes)
+	assert.Empty(files)
+
+	err = p.ParseArgs([]string{"--count", "foo", "/tmp"})
+	assert.IsType(&InvalidOptionValueError{}, err)
+
+	assert.Panics(func() {
+		var c chan int
+		p.AddOptionVar(&c, "", "chan", "", "", "")
+	})
+
+	assert.Panics(func() {
+		var c chan int
+		p.AddTrailingArgumentVar(&c, "chan", "")
+	})
+
+	assert.Panics(func() {
+		var b bool
+		p.AddOptionVar(&b, "", "bool-var", "", "maybe", "")
+	})
+
+	var ids []string
+	p2 := NewProgram("test", "")
+	p2.AddOptionVar(testIdValue{&ids}, "", "id", "id", "1,x", "")
+	assert.Empty(ids)
+	assert.Panics(func() { p2.ParseArgs([]string{}) })
+
+	ids = nil
+	p2 = NewProgram("test", "")
+	p2.AddOptionVar(testIdValue{&ids}, "", "id", "id", "1", "")
+	assert.Empty(ids)
+	assert.NoError(p2.ParseArgs([]string{}))
+	assert.Equal([]string{"1"}, ids)
+
+	assert.Panics(func() {
+		p.AddNegatableFlag("", "negatable", "yes please", "")
+	})
+	assert.Len(p.arguments, 2)
+}
+
+func TestRepeatableOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := NewProgram("test", "")
+	p.AddOption("I", "include", "path", "", "").Repeatable = true
+	tags := p.AddOption("t", "tag", "tag", "a,b", "")
+	tags.Repeatable = true
+	tags.Separator = ","
+	p.AddOption("o", "output", "path", "", "")
+	p.SetMain(func(*Program) {})
+
+	err := p.ParseArgs([]string{})
+	require.NoError(err)
+	assert.Empty(p.OptionValues("include"))
+	assert.Equal([]string{"a", "b"}, p.OptionValues("tag"))
+
+	err = p.ParseArgs([]string{"-I", "x", "--include=y", "-Iz",
+		"-t", "c,d", "--tag", "e", "-o", "foo", "-o", "bar"})
+	require.NoError(err)
+	assert.Equal([]string{"x", "y", "z"}, p.OptionValues("include"))
+	assert.Equal([]string{"c", "d", "e"}, p.OptionValues("tag"))
+	assert.Equal([]string{"bar"}, p.OptionValues("output"))
+	assert.Equal("bar", p.OptionValue("output"))
+}
+
+func TestMapOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var env map[string]string
+
+	p := NewProgram("test", "")
+	p.AddTypedOption(OptionTypeMap, "l", "label", "", "", "")
+	p.AddOptionVar(&env, "e", "env", "", "", "")
+	p.SetMain(func(*Program) {})
+
+	err := p.ParseArgs([]string{})
+	require.NoError(err)
+	assert.Empty(p.MapOptionValue("label"))
+
+	err = p.ParseArgs([]string{"-l", "a=1", "--label", "b=x=y", "-l", "c=",
+		"-e", "HOME=/tmp"})
+	require.NoError(err)
+	assert.Equal(map[string]string{"a": "1", "b": "x=y", "c": ""},
+		p.MapOptionValue("label"))
+	assert.Equal(map[string]string{"HOME": "/tmp"}, env)
+	assert.Equal(map[string]string{"HOME": "/tmp"}, p.MapOptionValue("env"))
+
+	err = p.ParseArgs([]string{"-e", "USER=bob"})
+	require.NoError(err)
+	assert.Equal(map[string]string{"USER": "bob"}, env)
+
+	for _, args := range [][]string{
+		{"-l", "a"},
+		{"-l", "=1"},
+		{"-l", "a=1", "-l", "a=2"},
+	} {
+		err = p.ParseArgs(args)
+		assert.IsType(&InvalidOptionValueError{}, err, args)
+	}
+}
+
+func TestChoiceOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := NewProgram("test", "")
+	p.AddChoiceOption("f", "format", "format", "text",
+		[]string{"text", "json", "yaml"}, "")
+	p.SetMain(func(*Program) {})
+
+	err := p.ParseArgs([]string{})
+	require.NoError(err)
+	assert.Equal("text", p.OptionValue("format"))
+
+	err = p.ParseArgs([]string{"--format", "json"})
+	require.NoError(err)
+	assert.Equal("json", p.OptionValue("format"))
+
+	err = p.ParseArgs([]string{"-f", "xml"})
+	if assert.IsType(&InvalidOptionValueError{}, err) {
+		assert.Contains(err.Error(), "text, json, yaml")
+	}
+
+	assert.Panics(func() {
+		p.AddChoiceOption("", "mode", "", "c", []string{"a", "b"}, "")
+	})
+}
+
+type testIdValue struct {
+	ptr *[]string
+}
+
+func (v testIdValue) Set(s string) error {
+	if _, err := strconv.Atoi(s); err != nil {
+		return fmt.Errorf("invalid identifier")
+	}
+
+	*v.ptr = append(*v.ptr, s)
+	return nil
+}
+
+func (v testIdValue) String() string {
+	return strings.Join(*v.ptr, ",")
+}
+
+func (v testIdValue) Type() string {
+	return "id"
+}
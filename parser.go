@@ -18,90 +18,498 @@ package program
 import (
 	"os"
 	"strings"
+	"unicode/utf8"
 )
 
-func (p *Program) parse() {
-	args := os.Args[1:]
+type ParsingMode int
 
-	args = p.parseOptions(args, p.options)
+const (
+	// Options must precede the command name and the arguments. Global
+	// options can also be used after the command name.
+	ParsingModeDefault ParsingMode = iota
+
+	// Options can appear anywhere on the command line until "--", in any
+	// order relative to the command name and arguments (GNU getopt
+	// behaviour). Disabled if the POSIXLY_CORRECT environment variable is
+	// set.
+	ParsingModePermute
+
+	// Global options must precede the command name, command options must
+	// precede arguments, and the first non-option argument terminates
+	// options.
+	ParsingModePOSIX
+)
+
+func (p *Program) parsingMode() ParsingMode {
+	mode := p.ParsingMode
+
+	if mode == ParsingModePermute {
+		if _, found := os.LookupEnv("POSIXLY_CORRECT"); found {
+			mode = ParsingModePOSIX
+		}
+	}
+
+	return mode
+}
+
+func (p *Program) parse(args []string) error {
+	var err error
+
+	p.reset()
+
+	if p.parsingMode() == ParsingModePermute {
+		err = p.parsePermuted(args)
+	} else {
+		err = p.parseInOrder(args)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	p.setOptionSources(OptionSource{Type: OptionSourceCommandLine})
+
+	if !p.isBuiltinRequested() {
+		if err := p.applyEnvironment(); err != nil {
+			return err
+		}
+
+		if err := p.loadConfigFile(); err != nil {
+			return err
+		}
+
+		if err := p.checkRequiredOptions(); err != nil {
+			return err
+		}
+
+		if err := p.checkOptionConstraints(); err != nil {
+			return err
+		}
+	}
+
+	p.applyDefaultValues()
+
+	return nil
+}
+
+func (p *Program) isBuiltinRequested() bool {
+	// Help and generator commands must work even if the environment, the
+	// configuration file or required options are not correctly set up.
 
 	if p.IsOptionSet("help") {
-		return
+		return true
 	}
 
-	if len(p.commands) > 0 {
-		args = p.parseCommand(args)
+	return p.command != nil && p.command.builtin
+}
 
-		options := make(map[string]*Option)
-		for name, opt := range p.options {
-			options[name] = opt
+func (p *Program) activeOptions() []*Option {
+	return p.scopeOptions(p.command)
+}
+
+func (p *Program) scopeOptions(command *Command) []*Option {
+	// Return global options and the options of all commands in the chain
+	// leading to the command.
+
+	options := sortedOptions(p.options)
+
+	for _, c := range commandChain(command) {
+		options = append(options, sortedOptions(c.options)...)
+	}
+
+	return options
+}
+
+func (p *Program) checkRequiredOptions() error {
+	var names []string
+
+	for _, opt := range p.activeOptions() {
+		if opt.Required && (!opt.Set || opt.Negated) {
+			names = append(names, opt.name())
+		}
+	}
+
+	if len(names) > 0 {
+		return &MissingOptionsError{Options: names}
+	}
+
+	return nil
+}
+
+func (p *Program) applyDefaultValues() {
+	for _, opt := range sortedOptions(p.options) {
+		opt.applyDefaultValue()
+	}
+
+	p.walkCommands(func(c *Command) {
+		for _, opt := range sortedOptions(c.options) {
+			opt.applyDefaultValue()
 		}
-		for name, opt := range p.command.options {
+	})
+}
+
+func (p *Program) parseInOrder(args []string) error {
+	var endOfOptions bool
+	var err error
+
+	args, endOfOptions, err = p.parseOptions(args, p.options)
+	if err != nil {
+		return err
+	}
+
+	if p.IsOptionSet("help") {
+		return nil
+	}
+
+	for len(p.subcommands()) > 0 {
+		args, err = p.parseCommand(args)
+		if err != nil {
+			return err
+		}
+
+		if !endOfOptions {
+			args, endOfOptions, err = p.parseOptions(args, p.commandOptions())
+			if err != nil {
+				return err
+			}
+		}
+
+		if p.IsOptionSet("help") {
+			return nil
+		}
+	}
+
+	_, err = p.parseArguments(args, p.currentArguments())
+	return err
+}
+
+func (p *Program) parsePermuted(args []string) error {
+	var values []string
+	var err error
+
+	options := p.options
+
+	for len(args) > 0 {
+		arg := args[0]
+
+		if arg == "--" {
+			values = append(values, args[1:]...)
+			break
+		}
+
+		if isOption(arg) {
+			args, err = p.parseOption(args, options)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if len(p.subcommands()) > 0 {
+			args, err = p.parseCommand(args)
+			if err != nil {
+				return err
+			}
+
+			options = p.commandOptions()
+
+			continue
+		}
+
+		values = append(values, arg)
+		args = args[1:]
+	}
+
+	if p.IsOptionSet("help") {
+		return nil
+	}
+
+	// Command names can also be found after the "--" terminator.
+	for len(p.subcommands()) > 0 {
+		values, err = p.parseCommand(values)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = p.parseArguments(values, p.currentArguments())
+	return err
+}
+
+func (p *Program) subcommands() map[string]*Command {
+	if p.command == nil {
+		return p.commands
+	}
+
+	return p.command.commands
+}
+
+func (p *Program) currentArguments() []*Argument {
+	if p.command == nil {
+		return p.arguments
+	}
+
+	return p.command.arguments
+}
+
+func (p *Program) commandOptions() map[string]*Option {
+	if p.parsingMode() == ParsingModePOSIX {
+		return p.command.options
+	}
+
+	options := make(map[string]*Option)
+	for name, opt := range p.options {
+		options[name] = opt
+	}
+
+	for _, c := range commandChain(p.command) {
+		for name, opt := range c.options {
 			options[name] = opt
 		}
+	}
 
-		args = p.parseOptions(args, options)
+	return options
+}
 
-		args = p.parseArguments(args, p.command.arguments)
-	} else {
-		args = p.parseArguments(args, p.arguments)
+func commandChain(command *Command) []*Command {
+	var chain []*Command
+
+	for c := command; c != nil; c = c.parent {
+		chain = append([]*Command{c}, chain...)
+	}
+
+	return chain
+}
+
+func (p *Program) reset() {
+	p.command = nil
+
+	resetOptions := func(options map[string]*Option) {
+		for _, opt := range options {
+			opt.Set = false
+			opt.Negated = false
+			opt.Count = 0
+			opt.Value = ""
+			opt.Values = nil
+			opt.value = nil
+			opt.source = OptionSource{}
+
+			if v, ok := opt.Var.(resettableValue); ok {
+				v.reset()
+			}
+		}
 	}
+
+	resetArguments := func(arguments []*Argument) {
+		for _, arg := range arguments {
+			arg.Set = false
+			arg.Value = ""
+			arg.TrailingValues = nil
+
+			if v, ok := arg.Var.(resettableValue); ok {
+				v.reset()
+			}
+		}
+	}
+
+	resetOptions(p.options)
+	resetArguments(p.arguments)
+
+	p.walkCommands(func(c *Command) {
+		resetOptions(c.options)
+		resetArguments(c.arguments)
+	})
 }
 
-func (p *Program) parseOptions(args []string, options map[string]*Option) []string {
+func (p *Program) parseOptions(args []string, options map[string]*Option) ([]string, bool, error) {
+	// Return the remaining arguments and whether the "--" terminator was
+	// found, in which case it is consumed and all remaining arguments are
+	// positional values.
+
 	for len(args) > 0 {
 		arg := args[0]
 
-		isShort := len(arg) == 2 && arg[0] == '-' && arg[1] != '-'
-		isLong := len(arg) > 2 && arg[0:2] == "--"
+		if arg == "--" {
+			return args[1:], true, nil
+		}
 
-		if arg == "--" || !(isShort || isLong) {
+		if !isOption(arg) {
 			break
 		}
 
-		key := strings.TrimLeft(arg, "-")
+		var err error
+
+		args, err = p.parseOption(args, options)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return args, false, nil
+}
+
+func (p *Program) parseOption(args []string, options map[string]*Option) ([]string, error) {
+	if args[0][1] == '-' {
+		return p.parseLongOption(args, options)
+	}
+
+	return p.parseShortOptions(args, options)
+}
+
+func isOption(arg string) bool {
+	return len(arg) >= 2 && arg[0] == '-' && arg != "--"
+}
+
+func (p *Program) parseLongOption(args []string, options map[string]*Option) ([]string, error) {
+	key := args[0][2:]
+
+	var value string
+	var hasValue bool
+
+	if i := strings.IndexByte(key, '='); i >= 0 {
+		key, value = key[:i], key[i+1:]
+		hasValue = true
+	}
+
+	opt, found := options[key]
+	if !found {
+		opt = negatedOption(key, options)
+		if opt == nil {
+			return nil, &UnknownOptionError{Option: key}
+		}
+
+		if hasValue {
+			return nil, &UnexpectedOptionValueError{Option: key}
+		}
+
+		return args[1:], p.negateOptionFlag(opt, key)
+	}
+
+	if opt.isFlag() {
+		if hasValue {
+			return nil, &UnexpectedOptionValueError{Option: key}
+		}
+
+		return args[1:], p.setOptionFlag(opt, key)
+	}
+
+	if hasValue {
+		return args[1:], p.setOptionValue(opt, key, value)
+	}
+
+	if len(args) < 2 {
+		return nil, &MissingOptionValueError{Option: key}
+	}
+
+	return args[2:], p.setOptionValue(opt, key, args[1])
+}
+
+func negatedOption(key string, options map[string]*Option) *Option {
+	if !strings.HasPrefix(key, "no-") {
+		return nil
+	}
+
+	opt, found := options[key[3:]]
+	if !found || !opt.negatable() || opt.LongName != key[3:] {
+		return nil
+	}
+
+	return opt
+}
+
+func (p *Program) parseShortOptions(args []string, options map[string]*Option) ([]string, error) {
+	// Short options can be grouped in a single argument, e.g. "-abc". The
+	// last option of the group can take a value, either attached ("-cfoo"
+	// if it is the only option of the group) or as the next argument
+	// ("-abc foo"). Any other option taking a value is in the middle of the
+	// group, which is ambiguous and rejected.
+
+	cluster := args[0]
+	args = args[1:]
+
+	for i := 1; i < len(cluster); {
+		_, size := utf8.DecodeRuneInString(cluster[i:])
+		key := cluster[i : i+size]
+		rest := cluster[i+size:]
 
 		opt, found := options[key]
 		if !found {
-			p.fatal("unknown option %q", key)
+			return nil, &UnknownOptionError{Option: key}
 		}
 
-		opt.Set = true
+		if opt.isFlag() {
+			if err := p.setOptionFlag(opt, key); err != nil {
+				return nil, err
+			}
+
+			i += size
+			continue
+		}
 
-		if opt.ValueName == "" {
-			args = args[1:]
-		} else {
-			if len(args) < 2 {
-				p.fatal("missing value for option %q", key)
+		if rest == "" {
+			if len(args) == 0 {
+				return nil, &MissingOptionValueError{Option: key}
 			}
 
-			opt.Value = args[1]
+			return args[1:], p.setOptionValue(opt, key, args[0])
+		}
 
-			args = args[2:]
+		if i > 1 {
+			return nil, &InvalidOptionClusterError{
+				Cluster: cluster,
+				Option:  key,
+			}
 		}
+
+		return args, p.setOptionValue(opt, key, rest)
+	}
+
+	return args, nil
+}
+
+func (p *Program) setOptionFlag(opt *Option, key string) error {
+	if err := opt.setFlag(); err != nil {
+		return &InvalidOptionValueError{Option: key, Value: "true", Err: err}
 	}
 
-	return args
+	return nil
 }
 
-func (p *Program) parseCommand(args []string) []string {
+func (p *Program) negateOptionFlag(opt *Option, key string) error {
+	if err := opt.negateFlag(); err != nil {
+		return &InvalidOptionValueError{Option: key, Value: "false", Err: err}
+	}
+
+	return nil
+}
+
+func (p *Program) setOptionValue(opt *Option, key, value string) error {
+	if err := opt.setValue(value); err != nil {
+		return &InvalidOptionValueError{Option: key, Value: value, Err: err}
+	}
+
+	return nil
+}
+
+func (p *Program) parseCommand(args []string) ([]string, error) {
 	if len(args) == 0 {
-		p.fatal("missing command")
+		return nil, &MissingCommandError{}
 	}
 
 	name := args[0]
 
-	command, found := p.commands[name]
+	command, found := p.subcommands()[name]
 	if !found {
-		p.fatal("unknown command %q", name)
+		return nil, &UnknownCommandError{Command: name}
 	}
 
 	p.command = command
 
-	return args[1:]
+	return args[1:], nil
 }
 
-func (p *Program) parseArguments(args []string, arguments []*Argument) []string {
+func (p *Program) parseArguments(args []string, arguments []*Argument) ([]string, error) {
 	if len(arguments) > 0 {
 		// Mandatory arguments
 		min := 0
@@ -114,14 +522,18 @@ func (p *Program) parseArguments(args []string, arguments []*Argument) []string
 		}
 
 		if len(args) < min {
-			p.fatal("missing argument(s)")
+			var names []string
+			for _, argument := range arguments[len(args):min] {
+				names = append(names, argument.Name)
+			}
+
+			return nil, &MissingArgumentsError{Arguments: names}
 		}
 
 		for i := 0; i < min; i++ {
-			argument := arguments[i]
-
-			argument.Set = true
-			argument.Value = args[i]
+			if err := p.setArgumentValue(arguments[i], args[i]); err != nil {
+				return nil, err
+			}
 		}
 
 		args = args[min:]
@@ -140,22 +552,41 @@ func (p *Program) parseArguments(args []string, arguments []*Argument) []string
 				break
 			}
 
-			argument.Set = true
-			argument.Value = args[0]
+			if err := p.setArgumentValue(argument, args[0]); err != nil {
+				return nil, err
+			}
 
 			args = args[1:]
 		}
 
 		// Trailing argument
 		if trailingArgument != nil {
-			trailingArgument.TrailingValues = args
-			args = args[len(args):]
-		} else {
-			if len(args) > 0 {
-				p.fatal("too many arguments")
+			for _, arg := range args {
+				err := p.setArgumentValue(trailingArgument, arg)
+				if err != nil {
+					return nil, err
+				}
 			}
+
+			args = args[len(args):]
+		}
+	}
+
+	if len(args) > 0 {
+		return nil, &TooManyArgumentsError{}
+	}
+
+	return args, nil
+}
+
+func (p *Program) setArgumentValue(arg *Argument, value string) error {
+	if err := arg.setValue(value); err != nil {
+		return &InvalidArgumentValueError{
+			Argument: arg.Name,
+			Value:    value,
+			Err:      err,
 		}
 	}
 
-	return args
+	return nil
 }
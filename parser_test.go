@@ -0,0 +1,454 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProgram() *Program {
+	p := NewProgram("test", "a test program")
+
+	p.AddFlag("", "flag-a", "a long flag")
+	p.AddFlag("b", "", "a short flag")
+	p.AddOption("c", "option-c", "value", "foo", "an option")
+
+	c := p.AddCommand("foo", "foo command", func(*Program) {})
+	c.AddFlag("d", "flag-d", "a command flag")
+	c.AddArgument("arg-1", "the first argument")
+	c.AddArgument("arg-2", "the second argument")
+	c.AddTrailingArgument("arg-3", "all trailing arguments")
+
+	c = p.AddCommand("bar", "bar command", func(*Program) {})
+	c.AddOptionalArgument("arg-opt", "the optional argument")
+
+	return p
+}
+
+func TestParseArgs(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+
+	err := p.ParseArgs([]string{"--flag-a", "-c", "bar", "foo", "-d",
+		"a1", "a2", "a3", "a4"})
+	require.NoError(err)
+
+	assert.Equal("foo", p.CommandName())
+	assert.True(p.IsOptionSet("flag-a"))
+	assert.False(p.IsOptionSet("b"))
+	assert.Equal("bar", p.OptionValue("option-c"))
+	assert.True(p.IsOptionSet("flag-d"))
+	assert.Equal("a1", p.ArgumentValue("arg-1"))
+	assert.Equal("a2", p.ArgumentValue("arg-2"))
+	assert.Equal([]string{"a3", "a4"}, p.TrailingArgumentValues("arg-3"))
+
+	err = p.ParseArgs([]string{"bar"})
+	require.NoError(err)
+
+	assert.Equal("bar", p.CommandName())
+	assert.False(p.IsOptionSet("flag-a"))
+	assert.Equal("foo", p.OptionValue("option-c"))
+	assert.Equal("", p.ArgumentValue("arg-opt"))
+}
+
+func TestParseArgsShortOptionClusters(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+
+	err := p.ParseArgs([]string{"-qb", "bar"})
+	require.NoError(err)
+	assert.True(p.IsOptionSet("quiet"))
+	assert.True(p.IsOptionSet("b"))
+
+	err = p.ParseArgs([]string{"-cvalue", "bar"})
+	require.NoError(err)
+	assert.Equal("value", p.OptionValue("option-c"))
+
+	err = p.ParseArgs([]string{"-bqc", "value", "foo", "-d", "a1", "a2"})
+	require.NoError(err)
+	assert.True(p.IsOptionSet("b"))
+	assert.True(p.IsOptionSet("quiet"))
+	assert.Equal("value", p.OptionValue("option-c"))
+}
+
+func TestParseArgsLongOptionValues(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+
+	tests := []struct {
+		arg   string
+		value string
+	}{
+		{"--option-c=bar", "bar"},
+		{"--option-c=a=b", "a=b"},
+		{"--option-c=", ""},
+	}
+
+	for _, test := range tests {
+		err := p.ParseArgs([]string{test.arg, "bar"})
+		require.NoError(err, test.arg)
+
+		assert.True(p.IsOptionSet("option-c"), test.arg)
+		assert.Equal(test.value, p.OptionValue("option-c"), test.arg)
+	}
+}
+
+func TestParseArgsOptionTerminator(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+
+	err := p.ParseArgs([]string{"foo", "-d", "--", "-a1", "--", "-a3"})
+	require.NoError(err)
+	assert.True(p.IsOptionSet("flag-d"))
+	assert.Equal("-a1", p.ArgumentValue("arg-1"))
+	assert.Equal("--", p.ArgumentValue("arg-2"))
+	assert.Equal([]string{"-a3"}, p.TrailingArgumentValues("arg-3"))
+
+	err = p.ParseArgs([]string{"-b", "--", "foo", "-d", "a2"})
+	require.NoError(err)
+	assert.True(p.IsOptionSet("b"))
+	assert.False(p.IsOptionSet("flag-d"))
+	assert.Equal("-d", p.ArgumentValue("arg-1"))
+	assert.Equal("a2", p.ArgumentValue("arg-2"))
+	assert.Empty(p.TrailingArgumentValues("arg-3"))
+}
+
+func TestParseArgsParsingModes(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var p *Program
+	var err error
+
+	p = newTestProgram()
+	err = p.ParseArgs([]string{"bar", "a1", "-b"})
+	assert.IsType(&TooManyArgumentsError{}, err)
+
+	p = newTestProgram()
+	p.ParsingMode = ParsingModePermute
+	err = p.ParseArgs([]string{"bar", "a1", "-b"})
+	require.NoError(err)
+	assert.Equal("a1", p.ArgumentValue("arg-opt"))
+	assert.True(p.IsOptionSet("b"))
+
+	p = newTestProgram()
+	p.ParsingMode = ParsingModePermute
+	err = p.ParseArgs([]string{"foo", "a1", "--flag-d", "a2", "-b", "--",
+		"-a3"})
+	require.NoError(err)
+	assert.Equal("foo", p.CommandName())
+	assert.True(p.IsOptionSet("flag-d"))
+	assert.True(p.IsOptionSet("b"))
+	assert.Equal("a1", p.ArgumentValue("arg-1"))
+	assert.Equal("a2", p.ArgumentValue("arg-2"))
+	assert.Equal([]string{"-a3"}, p.TrailingArgumentValues("arg-3"))
+
+	p = newTestProgram()
+	p.ParsingMode = ParsingModePermute
+	err = p.ParseArgs([]string{"-b", "--", "foo", "-d", "a2"})
+	require.NoError(err)
+	assert.Equal("foo", p.CommandName())
+	assert.Equal("-d", p.ArgumentValue("arg-1"))
+
+	t.Setenv("POSIXLY_CORRECT", "1")
+
+	p = newTestProgram()
+	p.ParsingMode = ParsingModePermute
+	err = p.ParseArgs([]string{"bar", "a1", "-b"})
+	assert.IsType(&TooManyArgumentsError{}, err)
+
+	p = newTestProgram()
+	p.ParsingMode = ParsingModePOSIX
+	err = p.ParseArgs([]string{"foo", "-b", "a1", "a2"})
+	assert.IsType(&UnknownOptionError{}, err)
+}
+
+func TestParseArgsSubcommands(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+
+	cluster := p.AddCommand("cluster", "cluster command", nil)
+	cluster.AddOption("n", "name", "name", "default", "the cluster name")
+
+	node := cluster.AddCommand("node", "node command", nil)
+
+	add := node.AddCommand("add", "add command", func(*Program) {})
+	add.AddFlag("f", "force", "force addition")
+	add.AddArgument("address", "the address of the node")
+
+	assert.Panics(func() {
+		add.AddFlag("n", "", "a duplicate flag")
+	})
+
+	assert.Panics(func() {
+		p.AddFlag("f", "", "a duplicate flag")
+	})
+
+	err := p.ParseArgs([]string{"-b", "cluster", "-n", "foo", "node", "add",
+		"-f", "localhost"})
+	require.NoError(err)
+	assert.Equal("add", p.CommandName())
+	assert.Equal([]string{"cluster", "node", "add"}, p.CommandPath())
+	assert.True(p.IsOptionSet("b"))
+	assert.Equal("foo", p.OptionValue("name"))
+	assert.True(p.IsOptionSet("force"))
+	assert.Equal("localhost", p.ArgumentValue("address"))
+
+	p.ParsingMode = ParsingModePermute
+	err = p.ParseArgs([]string{"cluster", "node", "add", "localhost",
+		"--force", "--name", "foo"})
+	require.NoError(err)
+	assert.Equal([]string{"cluster", "node", "add"}, p.CommandPath())
+	assert.Equal("foo", p.OptionValue("name"))
+	assert.True(p.IsOptionSet("force"))
+
+	err = p.ParseArgs([]string{"cluster", "node"})
+	assert.IsType(&MissingCommandError{}, err)
+
+	err = p.ParseArgs([]string{"cluster", "foo"})
+	assert.IsType(&UnknownCommandError{}, err)
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		args []string
+		err  error
+	}{
+		{[]string{"--foo"},
+			&UnknownOptionError{Option: "foo"}},
+		{[]string{"-c"},
+			&MissingOptionValueError{Option: "c"}},
+		{[]string{"-bc"},
+			&MissingOptionValueError{Option: "c"}},
+		{[]string{"--flag-a=true", "bar"},
+			&UnexpectedOptionValueError{Option: "flag-a"}},
+		{[]string{"--foo=bar", "bar"},
+			&UnknownOptionError{Option: "foo"}},
+		{[]string{"-bx", "bar"},
+			&UnknownOptionError{Option: "x"}},
+		{[]string{"-bcvalue", "bar"},
+			&InvalidOptionClusterError{Cluster: "-bcvalue", Option: "c"}},
+		{[]string{"-bcq", "bar"},
+			&InvalidOptionClusterError{Cluster: "-bcq", Option: "c"}},
+		{[]string{},
+			&MissingCommandError{}},
+		{[]string{"baz"},
+			&UnknownCommandError{Command: "baz"}},
+		{[]string{"foo", "a1"},
+			&MissingArgumentsError{Arguments: []string{"arg-2"}}},
+		{[]string{"bar", "a1", "a2"},
+			&TooManyArgumentsError{}},
+		{[]string{"--debug", "-1", "bar"},
+			&InvalidOptionValueError{Option: "debug", Value: "-1"}},
+	}
+
+	for _, test := range tests {
+		err := newTestProgram().ParseArgs(test.args)
+		if assert.Error(err, test.args) {
+			assert.IsType(test.err, err, test.args)
+		}
+	}
+}
+
+func TestParseArgsWithoutArguments(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestProgram()
+	p.AddCommand("noargs", "", func(*Program) {})
+
+	assert.NoError(p.ParseArgs([]string{"noargs"}))
+	assert.IsType(&TooManyArgumentsError{},
+		p.ParseArgs([]string{"noargs", "extra"}))
+
+	p = NewProgram("test", "")
+	p.SetMain(func(*Program) {})
+
+	assert.NoError(p.ParseArgs([]string{}))
+	assert.IsType(&TooManyArgumentsError{}, p.ParseArgs([]string{"extra"}))
+
+	assert.NoError(p.ParseArgs([]string{"-q", "--debug", "3"}))
+	assert.True(p.Quiet)
+	assert.Equal(3, p.DebugLevel)
+
+	assert.NoError(p.ParseArgs([]string{}))
+	assert.False(p.Quiet)
+	assert.Equal(0, p.DebugLevel)
+}
+
+func TestParseArgsCountedFlags(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+	p.SetDebugFlag("v", "verbose", "increase the debug level")
+
+	c := p.commands["bar"]
+	c.AddCountedFlag("x", "", "a counted flag")
+
+	err := p.ParseArgs([]string{"-vv", "-b", "bar", "--verbose", "-xbx"})
+	require.NoError(err)
+	assert.Equal(3, p.OptionCount("verbose"))
+	assert.Equal(3, p.DebugLevel)
+	assert.Equal(2, p.OptionCount("x"))
+	assert.Equal(2, p.OptionCount("b"))
+	assert.Equal(0, p.OptionCount("flag-a"))
+
+	err = p.ParseArgs([]string{"--debug", "1", "bar"})
+	assert.IsType(&UnknownOptionError{}, err)
+
+	x := c.options["x"]
+	assert.Equal("-x", x.usage())
+	assert.Equal([]string{"can be repeated"}, p.optionNotes(x))
+	assert.False(x.Repeatable)
+}
+
+func TestParseArgsNegatableFlags(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var cache bool
+
+	p := newTestProgram()
+	p.AddNegatableFlag("", "color", "true", "use colors")
+	p.AddOptionVar(&cache, "", "cache", "", "true", "use the cache").
+		Negatable = true
+
+	err := p.ParseArgs([]string{"bar"})
+	require.NoError(err)
+	assert.False(p.IsOptionSet("color"))
+	assert.True(p.BoolOptionValue("color"))
+	assert.True(cache)
+
+	err = p.ParseArgs([]string{"--no-color", "--no-cache", "bar"})
+	require.NoError(err)
+	assert.True(p.IsOptionSet("color"))
+	assert.Equal("false", p.OptionValue("color"))
+	assert.False(p.BoolOptionValue("color"))
+	assert.False(cache)
+
+	err = p.ParseArgs([]string{"--no-color", "--color", "bar"})
+	require.NoError(err)
+	assert.True(p.IsOptionSet("color"))
+	assert.Equal("true", p.OptionValue("color"))
+	assert.True(p.BoolOptionValue("color"))
+
+	err = p.ParseArgs([]string{"--flag-a", "--no-flag-a", "bar"})
+	require.NoError(err)
+	assert.True(p.IsOptionSet("flag-a"))
+	assert.False(p.BoolOptionValue("flag-a"))
+
+	err = p.ParseArgs([]string{"-q", "--no-quiet", "bar"})
+	require.NoError(err)
+	assert.False(p.Quiet)
+
+	err = p.ParseArgs([]string{"--no-help", "bar"})
+	assert.IsType(&UnknownOptionError{}, err)
+
+	err = p.ParseArgs([]string{"--no-option-c", "bar"})
+	assert.IsType(&UnknownOptionError{}, err)
+
+	err = p.ParseArgs([]string{"--no-color=true", "bar"})
+	assert.IsType(&UnexpectedOptionValueError{}, err)
+}
+
+func TestParseArgsNegatableTypedOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+	p.AddTypedOption(OptionTypeBool, "", "verify", "", "true",
+		"verify certificates").Negatable = true
+
+	err := p.ParseArgs([]string{"bar"})
+	require.NoError(err)
+	assert.True(p.BoolOptionValue("verify"))
+
+	err = p.ParseArgs([]string{"--no-verify", "bar"})
+	require.NoError(err)
+	assert.True(p.IsOptionSet("verify"))
+	assert.False(p.BoolOptionValue("verify"))
+}
+
+func TestNegatedOptionNameConflicts(t *testing.T) {
+	assert := assert.New(t)
+
+	p := newTestProgram()
+	p.AddFlag("", "cache", "")
+	assert.Panics(func() { p.AddFlag("", "no-cache", "") })
+	assert.Panics(func() {
+		p.commands["foo"].AddOption("", "no-cache", "x",
+			"", "")
+	})
+
+	p = newTestProgram()
+	p.AddOption("", "no-cache", "x", "", "")
+	assert.Panics(func() { p.commands["bar"].AddFlag("", "cache", "") })
+	assert.NotPanics(func() { p.AddOption("", "cache", "x", "", "") })
+}
+
+func TestParseArgsRequiredOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	p := newTestProgram()
+	p.AddOption("", "token", "token", "", "the api token").Required = true
+
+	c := p.commands["bar"]
+	c.AddOption("", "output", "path", "", "the output file").Required = true
+
+	err := p.ParseArgs([]string{"bar"})
+	var missingErr *MissingOptionsError
+	if assert.ErrorAs(err, &missingErr) {
+		assert.Equal([]string{"token", "output"}, missingErr.Options)
+	}
+
+	err = p.ParseArgs([]string{"--token", "x", "bar"})
+	if assert.ErrorAs(err, &missingErr) {
+		assert.Equal([]string{"output"}, missingErr.Options)
+	}
+
+	err = p.ParseArgs([]string{"--token", "x", "foo", "a1", "a2"})
+	require.NoError(err)
+
+	err = p.ParseArgs([]string{"--help"})
+	require.NoError(err)
+
+	err = p.ParseArgs([]string{"help", "bar"})
+	require.NoError(err)
+
+	p.AddFlag("", "accept", "accept the terms").Required = true
+
+	err = p.ParseArgs([]string{"--token", "x", "--no-accept", "foo", "a1",
+		"a2"})
+	if assert.ErrorAs(err, &missingErr) {
+		assert.Equal([]string{"accept"}, missingErr.Options)
+	}
+}
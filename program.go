@@ -25,14 +25,26 @@ type Main func(*Program)
 type Program struct {
 	Name        string
 	Description string
+	BuildId     *BuildId
 	Main        Main
+	ParsingMode ParsingMode
 
-	commands  map[string]*Command
-	options   map[string]*Option
-	arguments []*Argument
+	EnvironmentPrefix string
+
+	commands    map[string]*Command
+	options     map[string]*Option
+	arguments   []*Argument
+	constraints []*OptionConstraint
 
 	command *Command
 
+	debugFlag      *Option
+	manPageFlag    bool
+	definitionFlag bool
+
+	configDecoders map[string]ConfigDecoder
+	configPath     string
+
 	Quiet      bool
 	DebugLevel int
 }
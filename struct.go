@@ -0,0 +1,186 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Options and arguments can be declared with struct tags, e.g.:
+//
+//   type Options struct {
+//     OptionC string   `program:"short=c,long=option-c,value=value,default=foo" description:"an option"`
+//     Arg1    string   `arg:"arg-1" description:"the first argument"`
+//     Arg2    string   `arg:"arg-2,optional" description:"the second argument"`
+//     Files   []string `arg:"files,trailing" description:"the files"`
+//   }
+//
+// Fields are populated when the command line is parsed. Embedded structures
+// are processed recursively.
+
+func (p *Program) AddStruct(ptr interface{}) {
+	p.addStruct(nil, ptr)
+}
+
+func (c *Command) AddStruct(ptr interface{}) {
+	c.program.addStruct(c, ptr)
+}
+
+func (p *Program) addStruct(c *Command, ptr interface{}) {
+	value := reflect.ValueOf(ptr)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		panicf("%T is not a pointer to a structure", ptr)
+	}
+
+	p.addStructFields(c, value.Elem())
+}
+
+func (p *Program) addStructFields(c *Command, value reflect.Value) {
+	valueType := value.Type()
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		fieldValue := value.Field(i)
+
+		optionTag, isOption := field.Tag.Lookup("program")
+		argumentTag, isArgument := field.Tag.Lookup("arg")
+
+		if !isOption && !isArgument {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				p.addStructFields(c, fieldValue)
+			}
+
+			continue
+		}
+
+		if isOption && isArgument {
+			panicf("field %q cannot be both an option and an argument",
+				field.Name)
+		}
+
+		if field.PkgPath != "" {
+			panicf("field %q is not exported", field.Name)
+		}
+
+		fieldPtr := fieldValue.Addr().Interface()
+		description := field.Tag.Get("description")
+
+		if isOption {
+			p.addStructOption(c, fieldPtr, field.Name, optionTag, description)
+		} else {
+			p.addStructArgument(c, fieldPtr, field.Name, argumentTag,
+				description)
+		}
+	}
+}
+
+func (p *Program) addStructOption(c *Command, ptr interface{}, fieldName, tag, description string) {
+	var shortName, longName, valueName, defaultValue, envVar string
+	var negatable, required, secret bool
+	var choices []string
+
+	for _, part := range strings.Split(tag, ",") {
+		key, value := part, ""
+		if i := strings.IndexByte(part, '='); i >= 0 {
+			key, value = part[:i], part[i+1:]
+		}
+
+		switch key {
+		case "short":
+			shortName = value
+		case "long":
+			longName = value
+		case "value":
+			valueName = value
+		case "default":
+			defaultValue = value
+		case "env":
+			envVar = value
+		case "negatable":
+			negatable = true
+		case "required":
+			required = true
+		case "secret":
+			secret = true
+		case "choices":
+			choices = strings.Split(value, "|")
+		default:
+			panicf("invalid option tag entry %q for field %q", part, fieldName)
+		}
+	}
+
+	var option *Option
+
+	if c == nil {
+		option = p.AddOptionVar(ptr, shortName, longName, valueName,
+			defaultValue, description)
+	} else {
+		option = c.AddOptionVar(ptr, shortName, longName, valueName,
+			defaultValue, description)
+	}
+
+	option.Negatable = option.Negatable || negatable
+	option.EnvironmentVariable = envVar
+	option.Required = required
+	option.Secret = secret
+	option.Choices = choices
+
+	if defaultValue != "" {
+		if err := option.checkChoice(defaultValue); err != nil {
+			panicf("invalid default value %q for field %q: %v",
+				defaultValue, fieldName, err)
+		}
+	}
+}
+
+func (p *Program) addStructArgument(c *Command, ptr interface{}, fieldName, tag, description string) {
+	parts := strings.Split(tag, ",")
+
+	name := parts[0]
+	if name == "" {
+		panicf("missing argument name for field %q", fieldName)
+	}
+
+	var optional, trailing bool
+
+	for _, part := range parts[1:] {
+		switch part {
+		case "optional":
+			optional = true
+		case "trailing":
+			trailing = true
+		default:
+			panicf("invalid argument tag entry %q for field %q",
+				part, fieldName)
+		}
+	}
+
+	switch {
+	case trailing && c == nil:
+		p.AddTrailingArgumentVar(ptr, name, description)
+	case trailing:
+		c.AddTrailingArgumentVar(ptr, name, description)
+	case optional && c == nil:
+		p.AddOptionalArgumentVar(ptr, name, description)
+	case optional:
+		c.AddOptionalArgumentVar(ptr, name, description)
+	case c == nil:
+		p.AddArgumentVar(ptr, name, description)
+	default:
+		c.AddArgumentVar(ptr, name, description)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCommonOptions struct {
+	Verbose bool `program:"short=v,long=verbose" description:"verbose output"`
+}
+
+type testOptions struct {
+	testCommonOptions
+
+	OptionC string        `program:"short=c,long=option-c,value=value,default=foo" description:"an option"`
+	Timeout time.Duration `program:"long=timeout,default=5s" description:"a timeout"`
+	Color   bool          `program:"long=color,default=true,negatable" description:"use colors"`
+	Format  string        `program:"long=format,default=text,choices=text|json" description:"the output format"`
+	Arg1    string        `arg:"arg-1" description:"the first argument"`
+	Arg2    string        `arg:"arg-2,optional" description:"the second argument"`
+	Files   []string      `arg:"files,trailing" description:"the files"`
+
+	ignored int
+}
+
+func TestStruct(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var options testOptions
+
+	p := NewProgram("test", "")
+	c := p.AddCommand("foo", "", func(*Program) {})
+	c.AddStruct(&options)
+
+	err := p.ParseArgs([]string{"foo", "-v", "--timeout=1m", "--no-color",
+		"a1", "a2", "f1", "f2"})
+	require.NoError(err)
+	assert.True(options.Verbose)
+	assert.Equal("foo", options.OptionC)
+	assert.Equal(time.Minute, options.Timeout)
+	assert.False(options.Color)
+	assert.Equal("text", options.Format)
+	assert.Equal("a1", options.Arg1)
+	assert.Equal("a2", options.Arg2)
+	assert.Equal([]string{"f1", "f2"}, options.Files)
+	assert.Equal("foo", p.OptionValue("option-c"))
+
+	err = p.ParseArgs([]string{"foo", "-v", "--no-verbose", "a1"})
+	require.NoError(err)
+	assert.False(options.Verbose)
+
+	assert.Panics(func() {
+		p.AddStruct(options)
+	})
+
+	assert.Panics(func() {
+		var invalidOptions struct {
+			Foo string `program:"long=foo,bar=baz"`
+		}
+
+		p.AddStruct(&invalidOptions)
+	})
+}
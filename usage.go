@@ -21,6 +21,7 @@ import (
 	"io"
 	"os"
 	"sort"
+	"strings"
 )
 
 func (p *Program) PrintUsage(command *Command) {
@@ -30,88 +31,131 @@ func (p *Program) PrintUsage(command *Command) {
 	if command == nil {
 		programName = os.Args[0]
 	} else {
-		programName = os.Args[0] + " " + command.Name
+		programName = os.Args[0] + " " + command.FullName()
 	}
 
-	hasCommands := len(p.commands) > 0
-
+	var commands map[string]*Command
 	var arguments []*Argument
 	var description string
 
 	if command == nil {
+		commands = p.commands
 		arguments = p.arguments
 		description = p.Description
 	} else {
+		commands = command.commands
 		arguments = command.arguments
 		description = command.Description
 	}
 
-	hasArguments := len(arguments) > 0
-
 	maxWidth := p.computeMaxWidth(command)
 
-	if command == nil && hasCommands {
-		fmt.Fprintf(&buf, "Usage: %s OPTIONS <command>\n", programName)
-	} else if hasArguments {
-		var argBuf bytes.Buffer
-
-		for _, arg := range arguments {
-			if arg.Trailing {
-				fmt.Fprintf(&argBuf, " [<%s>...]", arg.Name)
-			} else if arg.Optional {
-				fmt.Fprintf(&argBuf, " [<%s>]", arg.Name)
-			} else {
-				fmt.Fprintf(&argBuf, " <%s>", arg.Name)
-			}
-		}
-
-		fmt.Fprintf(&buf, "Usage: %s OPTIONS%s\n", programName,
-			argBuf.String())
-	} else {
-		fmt.Fprintf(&buf, "Usage: %s OPTIONS\n", programName)
-	}
+	fmt.Fprintf(&buf, "Usage: %s %s\n", programName,
+		usageSynopsis(commands, arguments))
 
 	if description != "" {
 		fmt.Fprintf(&buf, "\n%s\n", sentence(description))
 	}
 
-	if command == nil && hasCommands {
-		p.usageCommands(&buf, maxWidth)
-	} else if hasArguments {
+	if len(commands) > 0 {
+		p.usageCommands(&buf, commands, maxWidth)
+	} else if len(arguments) > 0 {
 		p.usageArguments(&buf, arguments, maxWidth)
 	}
 
-	if len(p.options) > 0 {
-		if command != nil && len(command.options) > 0 {
-			p.usageOptions(&buf, "GLOBAL OPTIONS", p.options, maxWidth)
+	for _, group := range p.optionGroups(command) {
+		p.usageOptions(&buf, group.label, group.options, maxWidth)
+	}
+
+	p.usageConstraints(&buf, command)
+
+	io.Copy(os.Stderr, &buf)
+}
+
+func usageSynopsis(commands map[string]*Command, arguments []*Argument) string {
+	if len(commands) > 0 {
+		return "OPTIONS <command>"
+	}
+
+	var buf bytes.Buffer
+
+	buf.WriteString("OPTIONS")
+
+	for _, arg := range arguments {
+		if arg.Trailing {
+			fmt.Fprintf(&buf, " [<%s>...]", arg.Name)
+		} else if arg.Optional {
+			fmt.Fprintf(&buf, " [<%s>]", arg.Name)
 		} else {
-			p.usageOptions(&buf, "OPTIONS", p.options, maxWidth)
+			fmt.Fprintf(&buf, " <%s>", arg.Name)
 		}
 	}
 
-	if command != nil && len(command.options) > 0 {
-		p.usageOptions(&buf, "COMMAND OPTIONS", command.options, maxWidth)
-	}
+	return buf.String()
+}
 
-	io.Copy(os.Stderr, &buf)
+type optionGroup struct {
+	label   string
+	options map[string]*Option
 }
 
-func (p *Program) computeMaxWidth(command *Command) int {
-	max := 0
+func (p *Program) optionGroups(command *Command) []optionGroup {
+	var groups []optionGroup
 
-	for _, cmd := range p.commands {
-		if len(cmd.Name) > max {
-			max = len(cmd.Name)
+	var commandOptions map[string]*Option
+	inheritedOptions := make(map[string]*Option)
+
+	if command != nil {
+		commandOptions = command.options
+
+		for c := command.parent; c != nil; c = c.parent {
+			for name, opt := range c.options {
+				inheritedOptions[name] = opt
+			}
 		}
 	}
 
+	if len(p.options) > 0 {
+		label := "OPTIONS"
+		if len(commandOptions) > 0 || len(inheritedOptions) > 0 {
+			label = "GLOBAL OPTIONS"
+		}
+
+		groups = append(groups, optionGroup{label, p.options})
+	}
+
+	if len(inheritedOptions) > 0 {
+		groups = append(groups,
+			optionGroup{"INHERITED OPTIONS", inheritedOptions})
+	}
+
+	if len(commandOptions) > 0 {
+		groups = append(groups, optionGroup{"COMMAND OPTIONS", commandOptions})
+	}
+
+	return groups
+}
+
+func (p *Program) computeMaxWidth(command *Command) int {
+	max := 0
+
+	var commands map[string]*Command
 	var args []*Argument
+
 	if command == nil {
+		commands = p.commands
 		args = p.arguments
 	} else {
+		commands = command.commands
 		args = command.arguments
 	}
 
+	for _, cmd := range visibleCommands(commands) {
+		if len(cmd.Name) > max {
+			max = len(cmd.Name)
+		}
+	}
+
 	for _, arg := range args {
 		if len(arg.Name) > max {
 			max = len(arg.Name)
@@ -120,8 +164,12 @@ func (p *Program) computeMaxWidth(command *Command) int {
 
 	f := func(opt *Option) {
 		length := 2 + 2 + 2 + len(opt.LongName)
-		if opt.ValueName != "" {
-			length += 2 + len(opt.ValueName) + 1
+		if opt.negatable() {
+			length += len("[no-]")
+		}
+
+		if valueUsage := opt.valueUsage(); valueUsage != "" {
+			length += 1 + len(valueUsage)
 		}
 
 		if length > max {
@@ -133,8 +181,8 @@ func (p *Program) computeMaxWidth(command *Command) int {
 		f(opt)
 	}
 
-	if command != nil {
-		for _, opt := range command.options {
+	for c := command; c != nil; c = c.parent {
+		for _, opt := range c.options {
 			f(opt)
 		}
 	}
@@ -142,20 +190,12 @@ func (p *Program) computeMaxWidth(command *Command) int {
 	return max
 }
 
-func (p *Program) usageCommands(buf *bytes.Buffer, maxWidth int) {
+func (p *Program) usageCommands(buf *bytes.Buffer, commands map[string]*Command, maxWidth int) {
 	fmt.Fprintf(buf, "\nCOMMANDS\n\n")
 
-	names := []string{}
-
-	for name := range p.commands {
-		names = append(names, name)
-	}
-
-	sort.Strings(names)
-
-	for _, name := range names {
-		command := p.commands[name]
-		fmt.Fprintf(buf, "%-*s  %s\n", maxWidth, name, command.Description)
+	for _, command := range visibleCommands(commands) {
+		fmt.Fprintf(buf, "%-*s  %s\n", maxWidth, command.Name,
+			command.Description)
 	}
 }
 
@@ -170,57 +210,89 @@ func (p *Program) usageArguments(buf *bytes.Buffer, args []*Argument, maxWidth i
 func (p *Program) usageOptions(buf *bytes.Buffer, label string, options map[string]*Option, maxWidth int) {
 	fmt.Fprintf(buf, "\n%s\n\n", label)
 
-	strs := make(map[*Option]string)
+	for _, opt := range sortedOptions(options) {
+		str := opt.usage()
+		if opt.ShortName == "" {
+			str = "    " + str
+		}
 
-	for _, opt := range options {
-		if _, found := strs[opt]; found {
-			continue
+		fmt.Fprintf(buf, "%-*s  %s", maxWidth, str, opt.Description)
+
+		for _, note := range p.optionNotes(opt) {
+			fmt.Fprintf(buf, " (%s)", note)
 		}
 
-		buf := bytes.NewBuffer([]byte{})
+		fmt.Fprintf(buf, "\n")
+	}
+}
+
+func (opt *Option) usage() string {
+	// For example "-c, --[no-]color <when>".
 
-		if opt.ShortName == "" {
-			fmt.Fprintf(buf, "  ")
+	var names []string
+
+	if opt.ShortName != "" {
+		names = append(names, "-"+opt.ShortName)
+	}
+
+	if opt.LongName != "" {
+		if opt.negatable() {
+			names = append(names, "--[no-]"+opt.LongName)
 		} else {
-			fmt.Fprintf(buf, "-%s", opt.ShortName)
+			names = append(names, "--"+opt.LongName)
 		}
+	}
 
-		if opt.LongName != "" {
-			if opt.ShortName == "" {
-				buf.WriteString("  ")
-			} else {
-				buf.WriteString(", ")
-			}
+	s := strings.Join(names, ", ")
 
-			fmt.Fprintf(buf, "--%s", opt.LongName)
-		}
+	if valueUsage := opt.valueUsage(); valueUsage != "" {
+		s += " " + valueUsage
+	}
 
-		if opt.ValueName != "" {
-			fmt.Fprintf(buf, " <%s>", opt.ValueName)
-		}
+	return s
+}
+
+func (p *Program) optionNotes(opt *Option) []string {
+	var notes []string
+
+	if len(opt.Choices) > 0 {
+		notes = append(notes, "choices: "+strings.Join(opt.Choices, ", "))
+	}
+
+	if opt.Counted {
+		notes = append(notes, "can be repeated")
+	}
+
+	if name := p.optionEnvironmentVariable(opt); name != "" {
+		notes = append(notes, "env: "+name)
+	}
 
-		str := buf.String()
-		strs[opt] = str
+	if opt.Required {
+		notes = append(notes, "required")
+	} else if opt.DefaultValue != "" && !opt.Secret {
+		notes = append(notes, "default: "+opt.DefaultValue)
 	}
 
+	return notes
+}
+
+func sortedOptions(options map[string]*Option) []*Option {
 	var opts []*Option
-	for opt, _ := range strs {
-		opts = append(opts, opt)
+
+	seen := make(map[*Option]bool)
+
+	for _, opt := range options {
+		if !seen[opt] {
+			opts = append(opts, opt)
+			seen[opt] = true
+		}
 	}
 
 	sort.Slice(opts, func(i, j int) bool {
 		return opts[i].sortKey() < opts[j].sortKey()
 	})
 
-	for _, opt := range opts {
-		fmt.Fprintf(buf, "%-*s  %s", maxWidth, strs[opt], opt.Description)
-
-		if opt.DefaultValue != "" {
-			fmt.Fprintf(buf, " (default: %s)", opt.DefaultValue)
-		}
-
-		fmt.Fprintf(buf, "\n")
-	}
+	return opts
 }
 
 func (opt *Option) sortKey() string {
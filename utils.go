@@ -17,6 +17,7 @@ package program
 
 import (
 	"fmt"
+	"strings"
 	"unicode"
 )
 
@@ -38,3 +39,12 @@ func sentence(s string) string {
 
 	return string(runes)
 }
+
+func quotedNames(names []string) string {
+	quotedNames := make([]string, len(names))
+	for i, name := range names {
+		quotedNames[i] = fmt.Sprintf("%q", name)
+	}
+
+	return strings.Join(quotedNames, ", ")
+}
@@ -0,0 +1,370 @@
+// Copyright (c) 2021 Nicolas Martyanoff <khaelin@gmail.com>
+// Copyright (c) 2022 Exograd SAS.
+//
+// Permission to use, copy, modify, and distribute this software for any
+// purpose with or without fee is hereby granted, provided that the above
+// copyright notice and this permission notice appear in all copies.
+//
+// THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+// WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR ANY
+// SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+// ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF OR
+// IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+
+package program
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type BoolValue interface {
+	Value
+	IsBoolFlag() bool
+}
+
+// Values accumulating entries are cleared before each parsing so that
+// values from a previous call to ParseArgs are not kept.
+type resettableValue interface {
+	reset()
+}
+
+type stringValue struct {
+	ptr *string
+}
+
+func (v stringValue) Set(s string) error {
+	*v.ptr = s
+	return nil
+}
+
+func (v stringValue) String() string {
+	return *v.ptr
+}
+
+func (v stringValue) Type() string {
+	return "string"
+}
+
+type intValue struct {
+	ptr *int
+}
+
+func (v intValue) Set(s string) error {
+	i, err := strconv.ParseInt(s, 10, 0)
+	if err != nil {
+		return numberError(err, "integer")
+	}
+
+	*v.ptr = int(i)
+	return nil
+}
+
+func (v intValue) String() string {
+	return strconv.Itoa(*v.ptr)
+}
+
+func (v intValue) Type() string {
+	return "int"
+}
+
+type int64Value struct {
+	ptr *int64
+}
+
+func (v int64Value) Set(s string) error {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return numberError(err, "integer")
+	}
+
+	*v.ptr = i
+	return nil
+}
+
+func (v int64Value) String() string {
+	return strconv.FormatInt(*v.ptr, 10)
+}
+
+func (v int64Value) Type() string {
+	return "int64"
+}
+
+type uintValue struct {
+	ptr *uint
+}
+
+func (v uintValue) Set(s string) error {
+	i, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return numberError(err, "positive integer")
+	}
+
+	*v.ptr = uint(i)
+	return nil
+}
+
+func (v uintValue) String() string {
+	return strconv.FormatUint(uint64(*v.ptr), 10)
+}
+
+func (v uintValue) Type() string {
+	return "uint"
+}
+
+type float64Value struct {
+	ptr *float64
+}
+
+func (v float64Value) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return numberError(err, "number")
+	}
+
+	*v.ptr = f
+	return nil
+}
+
+func (v float64Value) String() string {
+	return strconv.FormatFloat(*v.ptr, 'g', -1, 64)
+}
+
+func (v float64Value) Type() string {
+	return "float64"
+}
+
+type boolValue struct {
+	ptr *bool
+}
+
+func (v boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid boolean")
+	}
+
+	*v.ptr = b
+	return nil
+}
+
+func (v boolValue) String() string {
+	return strconv.FormatBool(*v.ptr)
+}
+
+func (v boolValue) Type() string {
+	return "bool"
+}
+
+func (v boolValue) IsBoolFlag() bool {
+	return true
+}
+
+type durationValue struct {
+	ptr *time.Duration
+}
+
+func (v durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration")
+	}
+
+	*v.ptr = d
+	return nil
+}
+
+func (v durationValue) String() string {
+	return v.ptr.String()
+}
+
+func (v durationValue) Type() string {
+	return "duration"
+}
+
+type stringSliceValue struct {
+	ptr *[]string
+}
+
+func (v stringSliceValue) Set(s string) error {
+	*v.ptr = append(*v.ptr, s)
+	return nil
+}
+
+func (v stringSliceValue) reset() {
+	*v.ptr = nil
+}
+
+func (v stringSliceValue) String() string {
+	return strings.Join(*v.ptr, ",")
+}
+
+func (v stringSliceValue) Type() string {
+	return "string"
+}
+
+type mapValue struct {
+	ptr *map[string]string
+}
+
+func (v mapValue) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("invalid entry: expected <key>=<value>")
+	}
+
+	if *v.ptr == nil {
+		*v.ptr = make(map[string]string)
+	}
+
+	(*v.ptr)[s[:i]] = s[i+1:]
+	return nil
+}
+
+func (v mapValue) reset() {
+	*v.ptr = nil
+}
+
+func (v mapValue) String() string {
+	keys := make([]string, 0, len(*v.ptr))
+	for key := range *v.ptr {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	entries := make([]string, len(keys))
+	for i, key := range keys {
+		entries[i] = key + "=" + (*v.ptr)[key]
+	}
+
+	return strings.Join(entries, ",")
+}
+
+func (v mapValue) Type() string {
+	return "map"
+}
+
+func newVarValue(ptr interface{}) (Value, OptionType) {
+	switch v := ptr.(type) {
+	case Value:
+		return v, ""
+	case *string:
+		return stringValue{v}, OptionTypeString
+	case *int:
+		return intValue{v}, OptionTypeInt
+	case *int64:
+		return int64Value{v}, OptionTypeInt64
+	case *uint:
+		return uintValue{v}, OptionTypeUint
+	case *float64:
+		return float64Value{v}, OptionTypeFloat64
+	case *bool:
+		return boolValue{v}, OptionTypeBool
+	case *time.Duration:
+		return durationValue{v}, OptionTypeDuration
+	case *[]string:
+		return stringSliceValue{v}, ""
+	case *map[string]string:
+		return mapValue{v}, OptionTypeMap
+	}
+
+	panicf("unsupported variable type %T", ptr)
+	return nil, "" // make the compiler happy
+}
+
+func newVarOption(ptr interface{}, shortName, longName, valueName, defaultValue, description string) *Option {
+	value, optionType := newVarValue(ptr)
+
+	option := &Option{
+		ShortName:    shortName,
+		LongName:     longName,
+		ValueName:    valueName,
+		DefaultValue: defaultValue,
+		Description:  description,
+
+		Var: value,
+	}
+
+	if !option.isFlag() {
+		option.Type = optionType
+	}
+
+	switch value.(type) {
+	case stringSliceValue, mapValue:
+		option.Repeatable = true
+	}
+
+	return option
+}
+
+func (p *Program) AddOptionVar(ptr interface{}, shortName, longName, valueName, defaultValue, description string) *Option {
+	option := newVarOption(ptr, shortName, longName, valueName,
+		defaultValue, description)
+
+	p.addOption(nil, option)
+
+	return option
+}
+
+func (c *Command) AddOptionVar(ptr interface{}, shortName, longName, valueName, defaultValue, description string) *Option {
+	option := newVarOption(ptr, shortName, longName, valueName,
+		defaultValue, description)
+
+	c.program.addOption(c, option)
+
+	return option
+}
+
+func (p *Program) AddArgumentVar(ptr interface{}, name, description string) *Argument {
+	value, _ := newVarValue(ptr)
+
+	arg := p.AddArgument(name, description)
+	arg.Var = value
+	return arg
+}
+
+func (p *Program) AddOptionalArgumentVar(ptr interface{}, name, description string) *Argument {
+	value, _ := newVarValue(ptr)
+
+	arg := p.AddOptionalArgument(name, description)
+	arg.Var = value
+	return arg
+}
+
+func (p *Program) AddTrailingArgumentVar(ptr interface{}, name, description string) *Argument {
+	value, _ := newVarValue(ptr)
+
+	arg := p.AddTrailingArgument(name, description)
+	arg.Var = value
+	return arg
+}
+
+func (c *Command) AddArgumentVar(ptr interface{}, name, description string) *Argument {
+	value, _ := newVarValue(ptr)
+
+	arg := c.AddArgument(name, description)
+	arg.Var = value
+	return arg
+}
+
+func (c *Command) AddOptionalArgumentVar(ptr interface{}, name, description string) *Argument {
+	value, _ := newVarValue(ptr)
+
+	arg := c.AddOptionalArgument(name, description)
+	arg.Var = value
+	return arg
+}
+
+func (c *Command) AddTrailingArgumentVar(ptr interface{}, name, description string) *Argument {
+	value, _ := newVarValue(ptr)
+
+	arg := c.AddTrailingArgument(name, description)
+	arg.Var = value
+	return arg
+}